@@ -0,0 +1,287 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/kzmrv/gcsreader/internal/common"
+	pb "github.com/kzmrv/gcsreader/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	log "k8s.io/klog"
+)
+
+func (s *serverType) Aggregate(ctx context.Context, request *pb.AggregateRequest) (*pb.AggregateResult, error) {
+	defer common.TimeTrack(time.Now(), "Aggregate duration")
+	log.Infof("Received: aggregate group by %v, bucket %v, aggregators %v", request.GroupBy, request.TimeBucket, request.Aggregators)
+
+	if request.Work == nil {
+		return nil, status.Error(codes.InvalidArgument, "no work to aggregate")
+	}
+	aggregation, err := newAggregation(request)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	locations, filters, err := s.prepareWork(ctx, request.Work)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	limit := &resultLimit{maxLines: request.Work.MaxLines, maxBytes: request.Work.MaxBytes}
+	lineChannel := make(chan *lineEntry, s.lineBuffer)
+	go s.readObjects(ctx, locations, request.Work.Compression, lineChannel, filters)
+	var readErr error
+	for line := range lineChannel {
+		if line.err != nil {
+			readErr = line.err
+			continue
+		}
+		if line.malformed != nil {
+			aggregation.malformedLines++
+		}
+		if line.logEntry != nil {
+			if !limit.admit(len(*line.logEntry.log)) {
+				aggregation.limitReached = true
+				break
+			}
+			aggregation.add(line.logEntry)
+		}
+	}
+	if err := ctx.Err(); readErr == nil && err != nil {
+		readErr = status.FromContextError(err).Err()
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+	return aggregation.result(), nil
+}
+
+// aggregation accumulates aggregator state per time bucket and group.
+type aggregation struct {
+	groupBy     []func(e *auditEvent) []string
+	bucket      time.Duration
+	aggregators []*aggregator
+	columns     []string
+	groups      map[string]*aggregationGroup
+
+	malformedLines int64
+	limitReached   bool
+}
+
+type aggregationGroup struct {
+	bucket time.Time
+	keys   []string
+	states []*aggregatorState
+}
+
+type aggregator struct {
+	*pb.Aggregator
+	values func(e *auditEvent) []string
+}
+
+// aggregatorState keeps everything any aggregator type needs, values are
+// only collected for percentiles.
+type aggregatorState struct {
+	count  int64
+	sum    float64
+	min    float64
+	max    float64
+	values []float64
+}
+
+func newAggregation(request *pb.AggregateRequest) (*aggregation, error) {
+	// Lines are only counted, so settings shaping the returned lines
+	// would silently do nothing.
+	switch work := request.Work; {
+	case len(work.Projection) != 0:
+		return nil, fmt.Errorf("projections are not supported by aggregations")
+	case work.Cursor != nil:
+		return nil, fmt.Errorf("aggregations cannot be resumed from a cursor")
+	case work.Ordered:
+		return nil, fmt.Errorf("ordered results are not supported by aggregations")
+	case work.Deduplication != pb.Deduplication_DEDUPLICATION_NONE:
+		return nil, fmt.Errorf("deduplication is not supported by aggregations")
+	}
+	a := &aggregation{groups: map[string]*aggregationGroup{}}
+	for _, field := range request.GroupBy {
+		values, ok := resolveAuditField(field)
+		if !ok {
+			return nil, fmt.Errorf("unknown group by field %s", field)
+		}
+		a.groupBy = append(a.groupBy, values)
+		a.columns = append(a.columns, field)
+	}
+
+	if request.TimeBucket != nil {
+		bucket, err := ptypes.Duration(request.TimeBucket)
+		if err != nil || bucket < 0 {
+			return nil, fmt.Errorf("bad time bucket %v", request.TimeBucket)
+		}
+		a.bucket = bucket
+	}
+
+	aggregators := request.Aggregators
+	if len(aggregators) == 0 {
+		aggregators = []*pb.Aggregator{{Type: pb.AggregatorType_AGGREGATOR_COUNT}}
+	}
+	for _, spec := range aggregators {
+		agg := &aggregator{Aggregator: spec}
+		if spec.Type != pb.AggregatorType_AGGREGATOR_COUNT {
+			values, ok := resolveAuditField(spec.Field)
+			if !ok {
+				return nil, fmt.Errorf("unknown aggregator field %q", spec.Field)
+			}
+			agg.values = values
+		}
+		if spec.Type == pb.AggregatorType_AGGREGATOR_PERCENTILE && (spec.Percentile < 0 || spec.Percentile > 100) {
+			return nil, fmt.Errorf("percentile %v is not between 0 and 100", spec.Percentile)
+		}
+		a.aggregators = append(a.aggregators, agg)
+		a.columns = append(a.columns, agg.name())
+	}
+	return a, nil
+}
+
+func (a *aggregation) add(entry *logEntry) {
+	var bucket time.Time
+	if a.bucket != 0 {
+		bucket = entry.time.Truncate(a.bucket)
+	}
+	keys := make([]string, len(a.groupBy))
+	for i, values := range a.groupBy {
+		keys[i] = strings.Join(values(entry.event), ",")
+	}
+
+	id := bucket.Format(time.RFC3339Nano) + "\x00" + strings.Join(keys, "\x00")
+	group, ok := a.groups[id]
+	if !ok {
+		group = &aggregationGroup{bucket: bucket, keys: keys, states: make([]*aggregatorState, len(a.aggregators))}
+		for i := range group.states {
+			group.states[i] = &aggregatorState{min: math.Inf(1), max: math.Inf(-1)}
+		}
+		a.groups[id] = group
+	}
+
+	for i, agg := range a.aggregators {
+		state := group.states[i]
+		if agg.values == nil {
+			state.count++
+			continue
+		}
+		for _, raw := range agg.values(entry.event) {
+			value, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				continue
+			}
+			state.count++
+			state.sum += value
+			state.min = math.Min(state.min, value)
+			state.max = math.Max(state.max, value)
+			if agg.Type == pb.AggregatorType_AGGREGATOR_PERCENTILE {
+				state.values = append(state.values, value)
+			}
+		}
+	}
+}
+
+// result returns rows ordered by time bucket and then by group keys.
+func (a *aggregation) result() *pb.AggregateResult {
+	groups := make([]*aggregationGroup, 0, len(a.groups))
+	for _, group := range a.groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if !groups[i].bucket.Equal(groups[j].bucket) {
+			return groups[i].bucket.Before(groups[j].bucket)
+		}
+		for k := range groups[i].keys {
+			if groups[i].keys[k] != groups[j].keys[k] {
+				return groups[i].keys[k] < groups[j].keys[k]
+			}
+		}
+		return false
+	})
+
+	result := &pb.AggregateResult{
+		Columns:        a.columns,
+		Rows:           make([]*pb.AggregateRow, len(groups)),
+		MalformedLines: a.malformedLines,
+		LimitReached:   a.limitReached,
+	}
+	for i, group := range groups {
+		row := &pb.AggregateRow{Keys: group.keys, Values: make([]float64, len(a.aggregators))}
+		if a.bucket != 0 {
+			row.Bucket, _ = ptypes.TimestampProto(group.bucket)
+		}
+		for j, agg := range a.aggregators {
+			row.Values[j] = agg.value(group.states[j])
+		}
+		result.Rows[i] = row
+	}
+	return result
+}
+
+func (a *aggregator) name() string {
+	switch a.Type {
+	case pb.AggregatorType_AGGREGATOR_COUNT:
+		return "count"
+	case pb.AggregatorType_AGGREGATOR_PERCENTILE:
+		return fmt.Sprintf("p%v(%s)", a.Percentile, a.Field)
+	}
+	return fmt.Sprintf("%s(%s)", strings.ToLower(strings.TrimPrefix(a.Type.String(), "AGGREGATOR_")), a.Field)
+}
+
+// value computes the aggregator result, NaN when no values were seen.
+func (a *aggregator) value(state *aggregatorState) float64 {
+	if a.Type == pb.AggregatorType_AGGREGATOR_COUNT {
+		return float64(state.count)
+	}
+	if state.count == 0 {
+		return math.NaN()
+	}
+	switch a.Type {
+	case pb.AggregatorType_AGGREGATOR_SUM:
+		return state.sum
+	case pb.AggregatorType_AGGREGATOR_MIN:
+		return state.min
+	case pb.AggregatorType_AGGREGATOR_MAX:
+		return state.max
+	case pb.AggregatorType_AGGREGATOR_PERCENTILE:
+		return percentile(state.values, a.Percentile)
+	}
+	return math.NaN()
+}
+
+// percentile uses the nearest-rank method.
+func percentile(values []float64, p float64) float64 {
+	sort.Float64s(values)
+	rank := int(math.Ceil(p / 100 * float64(len(values))))
+	if rank < 1 {
+		rank = 1
+	}
+	return values[rank-1]
+}
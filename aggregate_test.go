@@ -0,0 +1,138 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/duration"
+	ts "github.com/golang/protobuf/ptypes/timestamp"
+	pb "github.com/kzmrv/gcsreader/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAggregateGroupBy(t *testing.T) {
+	path := writeTempFile(t, "audit.log.gz", gzipped(t, line1+"\n"+line2+"\n"+line3+"\n"))
+	defer os.RemoveAll(filepath.Dir(path))
+
+	result, err := newTestServer(nil).Aggregate(context.Background(), &pb.AggregateRequest{
+		Work:       aggregateWork(path),
+		GroupBy:    []string{"verb", "objectRef.resource"},
+		TimeBucket: &duration.Duration{Seconds: 60},
+		Aggregators: []*pb.Aggregator{
+			{Type: pb.AggregatorType_AGGREGATOR_COUNT},
+			{Type: pb.AggregatorType_AGGREGATOR_MAX, Field: "responseStatus.code"},
+			{Type: pb.AggregatorType_AGGREGATOR_MIN, Field: "objectRef.name"},
+			{Type: pb.AggregatorType_AGGREGATOR_PERCENTILE, Field: "latency", Percentile: 99},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedColumns := []string{"verb", "objectRef.resource", "count", "max(responseStatus.code)", "min(objectRef.name)", "p99(latency)"}
+	if !reflect.DeepEqual(result.Columns, expectedColumns) {
+		t.Fatalf("Expected columns %v, got %v", expectedColumns, result.Columns)
+	}
+	if len(result.Rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %v", result.Rows)
+	}
+	patch, update := result.Rows[0], result.Rows[1]
+	if !reflect.DeepEqual(patch.Keys, []string{"patch", "nodes"}) || !reflect.DeepEqual(update.Keys, []string{"update", "leases"}) {
+		t.Fatalf("Unexpected keys %v, %v", patch.Keys, update.Keys)
+	}
+	if update.Values[0] != 2 || update.Values[1] != 200 || !math.IsNaN(update.Values[2]) || update.Values[3] != 0.002074 {
+		t.Fatalf("Unexpected values %v", update.Values)
+	}
+	if update.Bucket.GetSeconds() != 1546441260 {
+		t.Fatalf("Unexpected bucket %v", update.Bucket)
+	}
+}
+
+func TestAggregateLimit(t *testing.T) {
+	path := writeTempFile(t, "audit.log.gz", gzipped(t, line1+"\n"+line2+"\n"+line3+"\n"))
+	defer os.RemoveAll(filepath.Dir(path))
+
+	for _, test := range []struct {
+		maxLines int64
+		count    float64
+		limited  bool
+	}{
+		{2, 2, true},
+		{3, 3, false},
+	} {
+		work := aggregateWork(path)
+		work.MaxLines = test.maxLines
+		result, err := newTestServer(nil).Aggregate(context.Background(), &pb.AggregateRequest{Work: work})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Rows) != 1 || result.Rows[0].Values[0] != test.count || result.LimitReached != test.limited {
+			t.Errorf("Expected %v lines counted with limit reached %v, got %v", test.count, test.limited, result)
+		}
+	}
+}
+
+func TestAggregatePercentile(t *testing.T) {
+	for _, test := range []struct {
+		percentile float64
+		expected   float64
+	}{
+		{0, 1},
+		{50, 5},
+		{90, 9},
+		{99, 10},
+		{100, 10},
+	} {
+		values := []float64{10, 9, 8, 7, 6, 5, 4, 3, 2, 1}
+		if result := percentile(values, test.percentile); result != test.expected {
+			t.Errorf("Expected p%v %v, got %v", test.percentile, test.expected, result)
+		}
+	}
+}
+
+func TestAggregateBadRequest(t *testing.T) {
+	for _, request := range []*pb.AggregateRequest{
+		{},
+		{Work: aggregateWork("/dev/null"), GroupBy: []string{"nonexistent"}},
+		{Work: aggregateWork("/dev/null"), Aggregators: []*pb.Aggregator{{Type: pb.AggregatorType_AGGREGATOR_SUM, Field: "nonexistent"}}},
+		{Work: aggregateWork("/dev/null"), Aggregators: []*pb.Aggregator{{Type: pb.AggregatorType_AGGREGATOR_PERCENTILE, Field: "responseStatus.code", Percentile: 101}}},
+		{Work: &pb.Work{File: "file:///dev/null", Projection: []string{"verb"}}},
+		{Work: &pb.Work{File: "file:///dev/null", Cursor: &pb.Cursor{Source: "file:///dev/null"}}},
+		{Work: &pb.Work{File: "file:///dev/null", Ordered: true}},
+		{Work: &pb.Work{File: "file:///dev/null", Deduplication: pb.Deduplication_DEDUPLICATION_LATEST_STAGE}},
+	} {
+		_, err := newTestServer(nil).Aggregate(context.Background(), request)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument for %v, got %v", request, err)
+		}
+	}
+}
+
+func aggregateWork(path string) *pb.Work {
+	return &pb.Work{
+		File:  "file://" + path,
+		Since: &ts.Timestamp{Seconds: 1546441200},
+		Until: &ts.Timestamp{Seconds: 1546441300},
+	}
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	pb "github.com/kzmrv/gcsreader/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// tarMagicOffset is where the "ustar" magic of a tar header starts.
+	tarMagicOffset = 257
+	tarMagic       = "ustar"
+)
+
+var zipMagic = []byte("PK\x03\x04")
+
+// splitArchiveMember splits "bundle.tar.gz#member" into the object path and
+// the member name or glob.
+func splitArchiveMember(objectPath string) (string, string) {
+	if i := strings.Index(objectPath, "#"); i != -1 {
+		return objectPath[:i], objectPath[i+1:]
+	}
+	return objectPath, ""
+}
+
+// readArchiveMembers streams matching lines of the tar or zip archive
+// members matching the location fragment. Each line is tagged with the
+// object and the member it was read from.
+func (s *serverType) readArchiveMembers(ctx context.Context, location *url.URL, compression pb.Compression, ch chan *lineEntry, filters *lineFilter) error {
+	reader, err := s.downloadAndDecompress(ctx, location, compression)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	matched := 0
+	readMember := func(name string, member io.Reader) error {
+		ok, err := path.Match(location.Fragment, name)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "bad member pattern %s: %v", location.Fragment, err)
+		}
+		if !ok {
+			return nil
+		}
+		matched++
+		source := *location
+		source.Fragment = name
+		start, ok := filters.cursor.start(source.String())
+		if !ok {
+			return nil
+		}
+		decompressed, err := decompress(member, pb.Compression_COMPRESSION_AUTO)
+		if err != nil {
+			return err
+		}
+		defer decompressed.Close()
+		if err := skipTo(decompressed, linePosition{}, start); err != nil {
+			return err
+		}
+		return getMatchingLinesFrom(ctx, decompressed, ch, filters, source.String(), start)
+	}
+
+	buffered := bufio.NewReader(reader)
+	header, _ := buffered.Peek(tarMagicOffset + len(tarMagic))
+	switch {
+	case bytes.HasPrefix(header, zipMagic):
+		err = forEachZipMember(buffered, readMember)
+	case len(header) == tarMagicOffset+len(tarMagic) && string(header[tarMagicOffset:]) == tarMagic:
+		err = forEachTarMember(buffered, readMember)
+	default:
+		return status.Errorf(codes.InvalidArgument, "%s is not a tar or zip archive", location)
+	}
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return status.Errorf(codes.NotFound, "no members of %s match %s", location, location.Fragment)
+	}
+	return nil
+}
+
+func forEachTarMember(reader io.Reader, fn func(name string, member io.Reader) error) error {
+	archive := tar.NewReader(reader)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return dataLossError(err)
+		}
+		if !header.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		if err := fn(header.Name, archive); err != nil {
+			return err
+		}
+	}
+}
+
+// forEachZipMember spools the archive to a temporary file first, since the
+// zip central directory sits at the end of the archive.
+func forEachZipMember(reader io.Reader, fn func(name string, member io.Reader) error) error {
+	file, err := ioutil.TempFile("", "gcsreader-zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	size, err := io.Copy(file, reader)
+	if err != nil {
+		return err
+	}
+
+	archive, err := zip.NewReader(file, size)
+	if err != nil {
+		return dataLossError(err)
+	}
+	for _, member := range archive.File {
+		if member.FileInfo().IsDir() {
+			continue
+		}
+		memberReader, err := member.Open()
+		if err != nil {
+			return dataLossError(err)
+		}
+		err = fn(member.Name, &checkedReader{memberReader})
+		memberReader.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	pb "github.com/kzmrv/gcsreader/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var archiveMembers = []struct {
+	name    string
+	content []byte
+}{
+	{"master-a/kube-apiserver-audit.log", []byte(line1 + "\n")},
+	{"master-b/kube-apiserver-audit.log.gz", nil},
+	{"master-b/kube-apiserver.log", []byte(line3 + "\n")},
+}
+
+func TestReadTarGzMembers(t *testing.T) {
+	var buffer bytes.Buffer
+	writer := tar.NewWriter(&buffer)
+	for _, member := range archiveMembers {
+		content := memberContent(t, member.name, member.content)
+		writer.WriteHeader(&tar.Header{Name: member.name, Mode: 0644, Size: int64(len(content))})
+		writer.Write(content)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	path := writeTempFile(t, "bundle.tar.gz", gzipped(t, buffer.String()))
+	defer os.RemoveAll(filepath.Dir(path))
+
+	lines, err := readArchiveLines(path + "#*/kube-apiserver-audit.log*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectMemberSources(t, path, lines, "master-a/kube-apiserver-audit.log", "master-b/kube-apiserver-audit.log.gz")
+}
+
+func TestReadZipMembers(t *testing.T) {
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	for _, member := range archiveMembers {
+		w, err := writer.Create(member.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(memberContent(t, member.name, member.content))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	path := writeTempFile(t, "bundle.zip", buffer.Bytes())
+	defer os.RemoveAll(filepath.Dir(path))
+
+	lines, err := readArchiveLines(path + "#master-a/kube-apiserver-audit.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectMemberSources(t, path, lines, "master-a/kube-apiserver-audit.log")
+
+	if _, err := readArchiveLines(path + "#master-c/*"); status.Code(err) != codes.NotFound {
+		t.Fatalf("Expected NotFound for unmatched member, got %v", err)
+	}
+}
+
+func memberContent(t *testing.T, name string, content []byte) []byte {
+	if filepath.Ext(name) == ".gz" {
+		return gzipped(t, line2+"\n")
+	}
+	return content
+}
+
+func readArchiveLines(objectPath string) ([]*logEntry, error) {
+	location, err := newTestServer(nil).parseObjectPath("", "file://"+objectPath)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan *lineEntry, 100)
+	err = newTestServer(nil).readObject(context.Background(), location, pb.Compression_COMPRESSION_AUTO, ch, &lineFilter{regex: regexp.MustCompile("")})
+	close(ch)
+	var lines []*logEntry
+	for line := range ch {
+		if line.logEntry != nil {
+			lines = append(lines, line.logEntry)
+		}
+	}
+	return lines, err
+}
+
+func expectMemberSources(t *testing.T, path string, lines []*logEntry, members ...string) {
+	if len(lines) != len(members) {
+		t.Fatalf("Expected %v lines, got %v", len(members), len(lines))
+	}
+	for i, member := range members {
+		if expected := "file://" + path + "#" + member; lines[i].source != expected {
+			t.Errorf("Expected source %s, got %s", expected, lines[i].source)
+		}
+	}
+}
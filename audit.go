@@ -0,0 +1,164 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported versions of the Kubernetes audit Event API.
+const (
+	auditAPIVersionV1      = "audit.k8s.io/v1"
+	auditAPIVersionV1beta1 = "audit.k8s.io/v1beta1"
+)
+
+// auditEvent mirrors the audit.k8s.io/v1 and v1beta1 Event fields the
+// worker uses. Request and response bodies are skipped while decoding.
+type auditEvent struct {
+	Kind                     string            `json:"kind"`
+	APIVersion               string            `json:"apiVersion"`
+	Level                    string            `json:"level"`
+	AuditID                  string            `json:"auditID"`
+	Stage                    string            `json:"stage"`
+	RequestURI               string            `json:"requestURI"`
+	Verb                     string            `json:"verb"`
+	User                     userInfo          `json:"user"`
+	ImpersonatedUser         *userInfo         `json:"impersonatedUser,omitempty"`
+	SourceIPs                []string          `json:"sourceIPs,omitempty"`
+	UserAgent                string            `json:"userAgent,omitempty"`
+	ObjectRef                *objectReference  `json:"objectRef,omitempty"`
+	ResponseStatus           *responseStatus   `json:"responseStatus,omitempty"`
+	RequestReceivedTimestamp time.Time         `json:"requestReceivedTimestamp"`
+	StageTimestamp           time.Time         `json:"stageTimestamp"`
+	Annotations              map[string]string `json:"annotations,omitempty"`
+
+	// Timestamp is only set by v1beta1, where it is the deprecated
+	// equivalent of RequestReceivedTimestamp.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type userInfo struct {
+	Username string              `json:"username,omitempty"`
+	UID      string              `json:"uid,omitempty"`
+	Groups   []string            `json:"groups,omitempty"`
+	Extra    map[string][]string `json:"extra,omitempty"`
+}
+
+type objectReference struct {
+	Resource        string `json:"resource,omitempty"`
+	Namespace       string `json:"namespace,omitempty"`
+	Name            string `json:"name,omitempty"`
+	UID             string `json:"uid,omitempty"`
+	APIGroup        string `json:"apiGroup,omitempty"`
+	APIVersion      string `json:"apiVersion,omitempty"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+	Subresource     string `json:"subresource,omitempty"`
+}
+
+type responseStatus struct {
+	Status  string `json:"status,omitempty"`
+	Message string `json:"message,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	Code    int32  `json:"code,omitempty"`
+}
+
+// receivedTimestamp is when the apiserver received the request, falling
+// back to the v1beta1 timestamp field for old events.
+func (e *auditEvent) receivedTimestamp() time.Time {
+	if e.RequestReceivedTimestamp.IsZero() {
+		return e.Timestamp
+	}
+	return e.RequestReceivedTimestamp
+}
+
+// latency is how long the apiserver took from receiving the request until
+// the event's stage. It is not known when either timestamp is missing.
+func (e *auditEvent) latency() (time.Duration, bool) {
+	received := e.receivedTimestamp()
+	if received.IsZero() || e.StageTimestamp.IsZero() {
+		return 0, false
+	}
+	return e.StageTimestamp.Sub(received), true
+}
+
+// auditFields extracts the values of named event fields. Fields such as
+// user.groups hold several values, missing fields hold none.
+var auditFields = map[string]func(e *auditEvent) []string{
+	"auditID":    func(e *auditEvent) []string { return nonEmpty(e.AuditID) },
+	"level":      func(e *auditEvent) []string { return nonEmpty(e.Level) },
+	"stage":      func(e *auditEvent) []string { return nonEmpty(e.Stage) },
+	"requestURI": func(e *auditEvent) []string { return nonEmpty(e.RequestURI) },
+	"verb":       func(e *auditEvent) []string { return nonEmpty(e.Verb) },
+	"userAgent":  func(e *auditEvent) []string { return nonEmpty(e.UserAgent) },
+	"sourceIPs":  func(e *auditEvent) []string { return e.SourceIPs },
+
+	"user.username": func(e *auditEvent) []string { return nonEmpty(e.User.Username) },
+	"user.uid":      func(e *auditEvent) []string { return nonEmpty(e.User.UID) },
+	"user.groups":   func(e *auditEvent) []string { return e.User.Groups },
+
+	"objectRef.resource":    objectRefField(func(r *objectReference) string { return r.Resource }),
+	"objectRef.subresource": objectRefField(func(r *objectReference) string { return r.Subresource }),
+	"objectRef.namespace":   objectRefField(func(r *objectReference) string { return r.Namespace }),
+	"objectRef.name":        objectRefField(func(r *objectReference) string { return r.Name }),
+	"objectRef.apiGroup":    objectRefField(func(r *objectReference) string { return r.APIGroup }),
+	"objectRef.apiVersion":  objectRefField(func(r *objectReference) string { return r.APIVersion }),
+
+	"responseStatus.code": func(e *auditEvent) []string {
+		if e.ResponseStatus == nil || e.ResponseStatus.Code == 0 {
+			return nil
+		}
+		return []string{strconv.Itoa(int(e.ResponseStatus.Code))}
+	},
+	// latency is in seconds, so queries and aggregations can treat it as
+	// any other number.
+	"latency": func(e *auditEvent) []string {
+		latency, ok := e.latency()
+		if !ok {
+			return nil
+		}
+		return []string{strconv.FormatFloat(latency.Seconds(), 'f', -1, 64)}
+	},
+}
+
+// resolveAuditField looks up a field by name, including annotations.<key>.
+func resolveAuditField(name string) (func(e *auditEvent) []string, bool) {
+	if values, ok := auditFields[name]; ok {
+		return values, true
+	}
+	if key := strings.TrimPrefix(name, "annotations."); key != name && key != "" {
+		return func(e *auditEvent) []string { return nonEmpty(e.Annotations[key]) }, true
+	}
+	return nil, false
+}
+
+func objectRefField(field func(r *objectReference) string) func(e *auditEvent) []string {
+	return func(e *auditEvent) []string {
+		if e.ObjectRef == nil {
+			return nil
+		}
+		return nonEmpty(field(e.ObjectRef))
+	}
+}
+
+func nonEmpty(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return []string{value}
+}
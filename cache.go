@@ -0,0 +1,324 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"expvar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	log "k8s.io/klog"
+)
+
+var (
+	cacheHits      = expvar.NewInt("cache_hits")
+	cacheMisses    = expvar.NewInt("cache_misses")
+	cacheEvictions = expvar.NewInt("cache_evictions")
+	cacheBytes     = expvar.NewInt("cache_bytes")
+)
+
+const (
+	cachedObjectSuffix = ".object"
+	// fetchPrefix starts the names of objects still being downloaded.
+	fetchPrefix = "fetch"
+)
+
+// objectCache keeps whole objects on local disk, named by the hash of
+// their location and generation, and evicts the least recently used ones
+// once they take more than maxBytes. Concurrent requests for an object
+// that is not cached yet share a single download.
+type objectCache struct {
+	dir      string
+	maxBytes int64
+
+	mu sync.Mutex
+	// lru holds *cacheEntry, most recently used first.
+	lru     *list.List
+	entries map[string]*list.Element
+	size    int64
+	fetches map[string]*cacheFetch
+}
+
+type cacheEntry struct {
+	key  string
+	size int64
+}
+
+// cacheFetch is a download other requests for the same object wait for.
+type cacheFetch struct {
+	done chan struct{}
+	err  error
+}
+
+// newObjectCache picks up objects cached by earlier runs, ordered by when
+// they were last read.
+func newObjectCache(dir string, maxBytes int64) (*objectCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+
+	c := &objectCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  map[string]*list.Element{},
+		fetches:  map[string]*cacheFetch{},
+	}
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), fetchPrefix) {
+			// Leftovers of interrupted downloads.
+			os.Remove(filepath.Join(dir, file.Name()))
+			continue
+		}
+		if !strings.HasSuffix(file.Name(), cachedObjectSuffix) {
+			continue
+		}
+		key := strings.TrimSuffix(file.Name(), cachedObjectSuffix)
+		c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, size: file.Size()})
+		c.size += file.Size()
+	}
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+	return c, nil
+}
+
+// cacheKey identifies the content of an object generation.
+func cacheKey(location *url.URL, generation int64) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s#%d", objectKey(location), generation)))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *objectCache) path(key string) string {
+	return filepath.Join(c.dir, key+cachedObjectSuffix)
+}
+
+// open returns the cached object for key. On a miss, the object is read
+// from fetch and written to the cache as it is read, so reading can start
+// right away; it is only cached once read to its end. Other requests for
+// it wait for that, and fetch it themselves when the first reader stops
+// early.
+func (c *objectCache) open(ctx context.Context, key string, fetch func(context.Context) (io.ReadCloser, error)) (io.ReadCloser, error) {
+	for {
+		c.mu.Lock()
+		if element, ok := c.entries[key]; ok {
+			c.lru.MoveToFront(element)
+			// Opening under the lock keeps eviction from removing the
+			// file first. Open files stay readable once removed.
+			file, err := os.Open(c.path(key))
+			c.mu.Unlock()
+			if err != nil {
+				return nil, err
+			}
+			cacheHits.Add(1)
+			log.Infof("Cache hit for %v", key)
+			now := time.Now()
+			os.Chtimes(file.Name(), now, now)
+			return file, nil
+		}
+		fetching, ok := c.fetches[key]
+		if !ok {
+			fetching = &cacheFetch{done: make(chan struct{})}
+			c.fetches[key] = fetching
+			c.mu.Unlock()
+
+			cacheMisses.Add(1)
+			log.Infof("Cache miss for %v", key)
+			return c.fetch(ctx, key, fetching, fetch)
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-fetching.done:
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+		// When the request downloading the object went away, the next
+		// one waiting downloads it instead.
+		if code := status.Code(fetching.err); fetching.err != nil && code != codes.Canceled && code != codes.DeadlineExceeded {
+			return nil, fetching.err
+		}
+	}
+}
+
+// fetch opens the object and returns a reader caching it as it is read.
+func (c *objectCache) fetch(ctx context.Context, key string, fetching *cacheFetch, fetch func(context.Context) (io.ReadCloser, error)) (io.ReadCloser, error) {
+	reader, err := fetch(ctx)
+	if err != nil {
+		c.finish(key, fetching, err)
+		return nil, err
+	}
+	file, err := ioutil.TempFile(c.dir, fetchPrefix)
+	if err != nil {
+		reader.Close()
+		c.finish(key, fetching, err)
+		return nil, err
+	}
+	return &cacheWriter{cache: c, key: key, fetching: fetching, reader: reader, file: file}, nil
+}
+
+// finish ends a fetch, waking up the requests waiting for it. A nil err
+// makes them look the object up again.
+func (c *objectCache) finish(key string, fetching *cacheFetch, err error) {
+	fetching.err = err
+	c.mu.Lock()
+	delete(c.fetches, key)
+	c.mu.Unlock()
+	close(fetching.done)
+}
+
+// add makes a fetched file the cached object for key.
+func (c *objectCache) add(key, name string, size int64) error {
+	if err := os.Rename(name, c.path(key)); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, size: size})
+	c.size += size
+	c.evict()
+	return nil
+}
+
+// cacheWriter passes an object through while writing it to a temporary
+// file, which is added to the cache once the object is read to its end.
+// Failing to write the file only stops caching.
+type cacheWriter struct {
+	cache    *objectCache
+	key      string
+	fetching *cacheFetch
+	reader   io.ReadCloser
+	// file is nil once the fetch is finished.
+	file *os.File
+	size int64
+}
+
+func (w *cacheWriter) Read(p []byte) (int, error) {
+	n, err := w.reader.Read(p)
+	if w.file == nil {
+		return n, err
+	}
+	if _, writeErr := w.file.Write(p[:n]); writeErr != nil {
+		log.Warningf("Failed to cache %v: %v", w.key, writeErr)
+		w.abandon()
+		return n, err
+	}
+	w.size += int64(n)
+	switch {
+	case err == io.EOF:
+		file := w.file
+		w.file = nil
+		closeErr := file.Close()
+		if closeErr == nil {
+			closeErr = w.cache.add(w.key, file.Name(), w.size)
+		}
+		if closeErr != nil {
+			log.Warningf("Failed to cache %v: %v", w.key, closeErr)
+			os.Remove(file.Name())
+		}
+		w.cache.finish(w.key, w.fetching, nil)
+	case err != nil:
+		w.abandon()
+	}
+	return n, err
+}
+
+// abandon drops what was written, so the next request for the object
+// fetches it again.
+func (w *cacheWriter) abandon() {
+	w.file.Close()
+	os.Remove(w.file.Name())
+	w.file = nil
+	w.cache.finish(w.key, w.fetching, nil)
+}
+
+func (w *cacheWriter) Close() error {
+	if w.file != nil {
+		w.abandon()
+	}
+	return w.reader.Close()
+}
+
+// evict removes the least recently used objects over maxBytes, but never
+// the most recent one.
+func (c *objectCache) evict() {
+	for c.size > c.maxBytes && c.lru.Len() > 1 {
+		entry := c.lru.Remove(c.lru.Back()).(*cacheEntry)
+		delete(c.entries, entry.key)
+		c.size -= entry.size
+		if err := os.Remove(c.path(entry.key)); err != nil {
+			log.Errorf("Failed to evict %v from the cache: %v", entry.key, err)
+		}
+		cacheEvictions.Add(1)
+		log.Infof("Evicted %v (%v bytes) from the cache", entry.key, entry.size)
+	}
+	cacheBytes.Set(c.size)
+}
+
+// cachedSource serves the objects of another source from a cache. Objects
+// without generations or larger than the cache are read directly.
+type cachedSource struct {
+	objectSource
+	cache *objectCache
+}
+
+func (s *cachedSource) open(ctx context.Context, location *url.URL, offset int64) (io.ReadCloser, error) {
+	info, err := s.objectSource.stat(ctx, location)
+	if status.Code(err) == codes.Unimplemented || (err == nil && info.size > s.cache.maxBytes) {
+		return s.objectSource.open(ctx, location, offset)
+	}
+	if err != nil {
+		return nil, err
+	}
+	reader, err := s.cache.open(ctx, cacheKey(location, info.generation), func(ctx context.Context) (io.ReadCloser, error) {
+		return s.objectSource.open(ctx, location, 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Objects being fetched are cached from their start, so the bytes
+	// before offset are read too.
+	if file, ok := reader.(*os.File); ok {
+		_, err = file.Seek(offset, io.SeekStart)
+	} else {
+		_, err = io.CopyN(ioutil.Discard, reader, offset)
+	}
+	if err != nil {
+		reader.Close()
+		return nil, storageError(err)
+	}
+	return reader, nil
+}
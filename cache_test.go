@@ -0,0 +1,241 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	pb "github.com/kzmrv/gcsreader/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestObjectCacheCoalescesFetches(t *testing.T) {
+	cache := newTestCache(t, 1<<20)
+	defer os.RemoveAll(cache.dir)
+
+	var fetches int32
+	release := make(chan struct{})
+	fetch := func(context.Context) (io.ReadCloser, error) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		return ioutil.NopCloser(strings.NewReader(line1)), nil
+	}
+	hits, misses := cacheHits.Value(), cacheMisses.Value()
+
+	var wg sync.WaitGroup
+	contents := make([]string, 5)
+	for i := range contents {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			file, err := cache.open(context.Background(), "key", fetch)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer file.Close()
+			content, _ := ioutil.ReadAll(file)
+			contents[i] = string(content)
+		}(i)
+	}
+	close(release)
+	wg.Wait()
+
+	if fetches != 1 {
+		t.Errorf("Expected a single fetch, got %v", fetches)
+	}
+	for _, content := range contents {
+		if content != line1 {
+			t.Errorf("Unexpected content %q", content)
+		}
+	}
+	if cacheHits.Value()-hits != 4 || cacheMisses.Value()-misses != 1 {
+		t.Errorf("Expected 4 hits and a miss, got %v and %v", cacheHits.Value()-hits, cacheMisses.Value()-misses)
+	}
+}
+
+func TestObjectCacheEviction(t *testing.T) {
+	cache := newTestCache(t, 10)
+	defer os.RemoveAll(cache.dir)
+	get := func(key string) error {
+		reader, err := cache.open(context.Background(), key, func(context.Context) (io.ReadCloser, error) {
+			return ioutil.NopCloser(strings.NewReader("1234")), nil
+		})
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		_, err = ioutil.ReadAll(reader)
+		return err
+	}
+	for _, key := range []string{"a", "b", "a", "c"} {
+		if err := get(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cached := func(cache *objectCache, key string) bool {
+		_, ok := cache.entries[key]
+		return ok
+	}
+	if !cached(cache, "a") || cached(cache, "b") || !cached(cache, "c") || cache.size != 8 {
+		t.Fatalf("Expected b to be evicted, got %v bytes in %v", cache.size, cache.entries)
+	}
+	if _, err := os.Stat(cache.path("b")); !os.IsNotExist(err) {
+		t.Fatalf("Expected the evicted object to be removed, got %v", err)
+	}
+
+	// A restarted worker keeps what was cached and removes interrupted
+	// downloads only.
+	interrupted := filepath.Join(cache.dir, fetchPrefix+"123")
+	other := filepath.Join(cache.dir, "other.gzindex")
+	for _, path := range []string{interrupted, other} {
+		if err := ioutil.WriteFile(path, []byte("1234"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reopened, err := newObjectCache(cache.dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cached(reopened, "a") || !cached(reopened, "c") || reopened.size != 8 {
+		t.Fatalf("Expected the cached objects after reopening, got %v", reopened.entries)
+	}
+	if _, err := os.Stat(interrupted); !os.IsNotExist(err) {
+		t.Errorf("Expected the interrupted download to be removed, got %v", err)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("Expected other files to be kept, got %v", err)
+	}
+}
+
+func TestObjectCacheStreamsFetches(t *testing.T) {
+	cache := newTestCache(t, 1<<20)
+	defer os.RemoveAll(cache.dir)
+	var fetches int32
+	pipes := make(chan *io.PipeWriter, 2)
+	fetch := func(context.Context) (io.ReadCloser, error) {
+		atomic.AddInt32(&fetches, 1)
+		reader, writer := io.Pipe()
+		pipes <- writer
+		return reader, nil
+	}
+
+	// The first bytes are read before the rest is downloaded.
+	reader, err := cache.open(context.Background(), "key", fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := <-pipes
+	go writer.Write([]byte("12"))
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(reader, head); err != nil || string(head) != "12" {
+		t.Fatalf("Expected the head of the object, got %q, %v", head, err)
+	}
+
+	// A request waiting for the download fetches the object itself once
+	// the first one stops early.
+	waited := make(chan string)
+	go func() {
+		reader, err := cache.open(context.Background(), "key", fetch)
+		if err != nil {
+			t.Error(err)
+			close(waited)
+			return
+		}
+		defer reader.Close()
+		content, _ := ioutil.ReadAll(reader)
+		waited <- string(content)
+	}()
+	reader.Close()
+	writer = <-pipes
+	writer.Write([]byte("1234"))
+	writer.Close()
+	if content := <-waited; content != "1234" || fetches != 2 {
+		t.Fatalf("Expected the object from a second fetch, got %q after %v fetches", content, fetches)
+	}
+	if _, ok := cache.entries["key"]; !ok || cache.size != 4 {
+		t.Fatalf("Expected the object read to its end to be cached, got %v", cache.entries)
+	}
+	files, _ := ioutil.ReadDir(cache.dir)
+	if len(files) != 1 {
+		t.Fatalf("Expected only the cached object left, got %v files", len(files))
+	}
+}
+
+func TestObjectCacheFetchErrors(t *testing.T) {
+	cache := newTestCache(t, 1<<20)
+	defer os.RemoveAll(cache.dir)
+	_, err := cache.open(context.Background(), "key", func(context.Context) (io.ReadCloser, error) {
+		return nil, status.Error(codes.NotFound, "not found")
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("Expected NotFound, got %v", err)
+	}
+	if len(cache.entries) != 0 || len(cache.fetches) != 0 {
+		t.Fatalf("Expected nothing cached, got %v", cache.entries)
+	}
+}
+
+func TestDoWorkFromCache(t *testing.T) {
+	gcs := newFakeGCS()
+	defer gcs.Close()
+	gcs.objects[defaultBucket+"/logs/audit.log.gz"] = gzipped(t, line1+"\n"+line2+"\n")
+	cache := newTestCache(t, 1<<20)
+	defer os.RemoveAll(cache.dir)
+	s := newTestServer(gcs.client(t))
+	s.sources["gs"] = &cachedSource{objectSource: s.sources["gs"], cache: cache}
+
+	for i := 0; i < 3; i++ {
+		stream := &fakeWorkStream{ctx: context.Background()}
+		if err := s.DoWork(&pb.Work{File: "logs/audit.log.gz"}, stream); err != nil {
+			t.Fatal(err)
+		}
+		if lines := stream.lines(); len(lines) != 2 {
+			t.Fatalf("Expected 2 lines, got %v", len(lines))
+		}
+	}
+	if downloads := gcs.downloads[defaultBucket+"/logs/audit.log.gz"]; downloads != 1 {
+		t.Fatalf("Expected a single download, got %v", downloads)
+	}
+
+	location := &url.URL{Scheme: "gs", Host: defaultBucket, Path: "/logs/audit.log.gz"}
+	if cacheKey(location, 1) == cacheKey(location, 2) {
+		t.Fatal("Expected generations of an object to be cached apart")
+	}
+}
+
+func newTestCache(t *testing.T, maxBytes int64) *objectCache {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache, err := newObjectCache(dir, maxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cache
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"io"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/zstd"
+	gzip "github.com/klauspost/pgzip"
+	pb "github.com/kzmrv/gcsreader/proto"
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// compressionMagics are the leading bytes identifying each format.
+var compressionMagics = []struct {
+	compression pb.Compression
+	magic       []byte
+}{
+	{pb.Compression_COMPRESSION_GZIP, []byte{0x1f, 0x8b}},
+	{pb.Compression_COMPRESSION_ZSTD, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{pb.Compression_COMPRESSION_BZIP2, []byte("BZh")},
+	{pb.Compression_COMPRESSION_XZ, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{pb.Compression_COMPRESSION_LZ4, []byte{0x04, 0x22, 0x4d, 0x18}},
+}
+
+// detectCompression sniffs the format from the first bytes of reader
+// without consuming them. Unknown content is treated as uncompressed.
+func detectCompression(reader *bufio.Reader) pb.Compression {
+	// Peek returns what is available together with an error for short
+	// objects, which are still worth checking.
+	header, _ := reader.Peek(6)
+	for _, format := range compressionMagics {
+		if bytes.HasPrefix(header, format.magic) {
+			return format.compression
+		}
+	}
+	return pb.Compression_COMPRESSION_NONE
+}
+
+// decompress wraps reader with a decompressor for compression, which is
+// detected from the content for COMPRESSION_AUTO. Corrupt content fails
+// with DataLoss.
+func decompress(reader io.Reader, compression pb.Compression) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(reader)
+	if compression == pb.Compression_COMPRESSION_AUTO {
+		compression = detectCompression(buffered)
+	}
+	decompressed, err := newDecompressor(buffered, compression)
+	if err != nil {
+		return nil, dataLossError(err)
+	}
+	return &checkedReader{decompressed}, nil
+}
+
+func newDecompressor(buffered *bufio.Reader, compression pb.Compression) (io.ReadCloser, error) {
+	switch compression {
+	case pb.Compression_COMPRESSION_NONE:
+		return ioutil.NopCloser(buffered), nil
+	case pb.Compression_COMPRESSION_GZIP:
+		return gzip.NewReader(buffered)
+	case pb.Compression_COMPRESSION_ZSTD:
+		decoder, err := zstd.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	case pb.Compression_COMPRESSION_BZIP2:
+		return ioutil.NopCloser(bzip2.NewReader(buffered)), nil
+	case pb.Compression_COMPRESSION_XZ:
+		decompressed, err := xz.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(decompressed), nil
+	case pb.Compression_COMPRESSION_LZ4:
+		return ioutil.NopCloser(lz4.NewReader(buffered)), nil
+	}
+	return nil, status.Errorf(codes.InvalidArgument, "unsupported compression %v", compression)
+}
+
+// dataLossError reports errors that are not already gRPC statuses, such as
+// those of the underlying object, as corrupt content.
+func dataLossError(err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Error(codes.DataLoss, err.Error())
+}
+
+// checkedReader reports decompression failures as DataLoss.
+type checkedReader struct {
+	io.ReadCloser
+}
+
+func (r *checkedReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	return n, dataLossError(err)
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	pb "github.com/kzmrv/gcsreader/proto"
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const compressedContent = "{\"kind\":\"Event\"}\n"
+
+// bzip2Content is compressedContent compressed with bzip2, which the
+// standard library can only decompress.
+var bzip2Content = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0xc9, 0x02, 0xe2, 0x5e, 0x00, 0x00,
+	0x07, 0xdd, 0x80, 0x00, 0x10, 0x10, 0x00, 0x00, 0x10, 0x02, 0x00, 0x06, 0x29, 0x05, 0x0a, 0x20,
+	0x00, 0x22, 0x8c, 0x68, 0x86, 0xf5, 0x08, 0x06, 0x80, 0x05, 0x05, 0xce, 0xac, 0x1c, 0x10, 0x2c,
+	0x17, 0x72, 0x45, 0x38, 0x50, 0x90, 0xc9, 0x02, 0xe2, 0x5e,
+}
+
+func TestDetectCompression(t *testing.T) {
+	for _, test := range []struct {
+		compression pb.Compression
+		content     []byte
+	}{
+		{pb.Compression_COMPRESSION_NONE, []byte(compressedContent)},
+		{pb.Compression_COMPRESSION_NONE, []byte{}},
+		{pb.Compression_COMPRESSION_GZIP, gzipped(t, compressedContent)},
+		{pb.Compression_COMPRESSION_ZSTD, compressWith(t, func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) })},
+		{pb.Compression_COMPRESSION_BZIP2, bzip2Content},
+		{pb.Compression_COMPRESSION_XZ, compressWith(t, func(w io.Writer) (io.WriteCloser, error) { return xz.NewWriter(w) })},
+		{pb.Compression_COMPRESSION_LZ4, compressWith(t, func(w io.Writer) (io.WriteCloser, error) { return lz4.NewWriter(w), nil })},
+	} {
+		detected := detectCompression(bufio.NewReader(bytes.NewReader(test.content)))
+		if detected != test.compression {
+			t.Errorf("Expected %v, detected %v", test.compression, detected)
+			continue
+		}
+		if len(test.content) == 0 {
+			continue
+		}
+
+		reader, err := decompress(bytes.NewReader(test.content), pb.Compression_COMPRESSION_AUTO)
+		if err != nil {
+			t.Fatalf("Failed to decompress %v: %v", test.compression, err)
+		}
+		content, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatalf("Failed to read %v: %v", test.compression, err)
+		}
+		if string(content) != compressedContent {
+			t.Errorf("Expected %v content %q, got %q", test.compression, compressedContent, content)
+		}
+	}
+}
+
+func TestDecompressOverride(t *testing.T) {
+	reader, err := decompress(bytes.NewReader(gzipped(t, compressedContent)), pb.Compression_COMPRESSION_NONE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, gzipped(t, compressedContent)) {
+		t.Fatal("Expected content to be passed through")
+	}
+
+	if _, err := decompress(bytes.NewReader([]byte(compressedContent)), pb.Compression_COMPRESSION_GZIP); err == nil {
+		t.Fatal("Expected error for plain content read as gzip")
+	}
+}
+
+func TestDecompressCorruptContent(t *testing.T) {
+	if _, err := decompress(bytes.NewReader([]byte(compressedContent)), pb.Compression_COMPRESSION_GZIP); status.Code(err) != codes.DataLoss {
+		t.Fatalf("Expected DataLoss for a bad gzip header, got %v", err)
+	}
+
+	corrupt := gzipped(t, compressedContent)
+	corrupt = corrupt[:len(corrupt)-4]
+	reader, err := decompress(bytes.NewReader(corrupt), pb.Compression_COMPRESSION_AUTO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(reader); status.Code(err) != codes.DataLoss {
+		t.Fatalf("Expected DataLoss for a truncated gzip stream, got %v", err)
+	}
+}
+
+func compressWith(t *testing.T, newWriter func(io.Writer) (io.WriteCloser, error)) []byte {
+	var buffer bytes.Buffer
+	writer, err := newWriter(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write([]byte(compressedContent)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
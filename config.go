@@ -0,0 +1,262 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/grpc"
+	grpccredentials "google.golang.org/grpc/credentials"
+	"sigs.k8s.io/yaml"
+)
+
+const defaultBucket = "kubernetes-jenkins"
+
+// serverConfig is the configuration of the worker. Defaults are overridden
+// by the YAML file given with --config, and that by flags set on the
+// command line.
+type serverConfig struct {
+	ListenAddress string `json:"listenAddress"`
+	// DefaultBucket is read when a request names no bucket.
+	DefaultBucket string `json:"defaultBucket"`
+	// AllowedBuckets are the GCS buckets requests may read from, only the
+	// default bucket when empty.
+	AllowedBuckets []string `json:"allowedBuckets,omitempty"`
+	// LocalRoot is the directory file:// objects may be read from, local
+	// files are disabled when empty.
+	LocalRoot string `json:"localRoot,omitempty"`
+	// AllowedHTTPHosts are the hosts http(s):// objects may be read from,
+	// optionally with a port. HTTP(S) is disabled when empty.
+	AllowedHTTPHosts []string `json:"allowedHTTPHosts,omitempty"`
+	// LineBuffer is how many lines are read ahead of sending them.
+	LineBuffer int `json:"lineBuffer"`
+	// OrderedBuffer is how many lines are read ahead of each object in
+	// ordered mode.
+	OrderedBuffer int `json:"orderedBuffer"`
+	// MaxOrderedObjects limits the objects of ordered requests, which are
+	// all read at once.
+	MaxOrderedObjects int `json:"maxOrderedObjects"`
+	// BatchSize is the most lines sent in a single result.
+	BatchSize int `json:"batchSize"`
+	// MaxConcurrentRequests limits the requests served at once, zero means
+	// no limit. Further requests fail with ResourceExhausted.
+	MaxConcurrentRequests int               `json:"maxConcurrentRequests"`
+	IndexDir              string            `json:"indexDir,omitempty"`
+	MetricsAddress        string            `json:"metricsAddress,omitempty"`
+	Cache                 cacheConfig       `json:"cache"`
+	TLS                   tlsConfig         `json:"tls"`
+	Credentials           credentialsConfig `json:"credentials"`
+}
+
+type cacheConfig struct {
+	// Dir caches downloaded GCS objects, caching is disabled when empty.
+	Dir      string `json:"dir,omitempty"`
+	MaxBytes int64  `json:"maxBytes"`
+}
+
+// tlsConfig enables TLS when a certificate is set. Clients must present a
+// certificate signed by ClientCAFile when it is set.
+type tlsConfig struct {
+	CertFile     string `json:"certFile,omitempty"`
+	KeyFile      string `json:"keyFile,omitempty"`
+	ClientCAFile string `json:"clientCAFile,omitempty"`
+}
+
+type credentialsConfig struct {
+	// Mode is anonymous, default or service-account.
+	Mode string `json:"mode"`
+	// File is the service account JSON key of the service-account mode.
+	File string `json:"file,omitempty"`
+}
+
+func defaultConfig() *serverConfig {
+	return &serverConfig{
+		ListenAddress:     ":17654",
+		DefaultBucket:     defaultBucket,
+		LineBuffer:        100000,
+		OrderedBuffer:     1000,
+		MaxOrderedObjects: 100,
+		BatchSize:         100,
+		Cache:             cacheConfig{MaxBytes: 50 << 30},
+		Credentials:       credentialsConfig{Mode: credentialsAnonymous},
+	}
+}
+
+// registerFlags adds a flag for every setting of c, defaulting to its
+// current value.
+func (c *serverConfig) registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.ListenAddress, "listen-address", c.ListenAddress, "Address to serve gRPC on")
+	fs.StringVar(&c.DefaultBucket, "default-bucket", c.DefaultBucket, "GCS bucket read when a request names none")
+	fs.Var((*stringList)(&c.AllowedBuckets), "allowed-buckets", "Comma-separated list of GCS buckets the worker may read from, only the default bucket when empty")
+	fs.StringVar(&c.LocalRoot, "local-root", c.LocalRoot, "Directory file:// objects may be read from; empty disables local files")
+	fs.Var((*stringList)(&c.AllowedHTTPHosts), "allowed-http-hosts", "Comma-separated list of hosts, optionally with a port, http(s):// objects may be read from; empty disables HTTP(S)")
+	fs.IntVar(&c.LineBuffer, "line-buffer", c.LineBuffer, "Number of lines read ahead of sending them")
+	fs.IntVar(&c.OrderedBuffer, "ordered-buffer", c.OrderedBuffer, "Number of lines read ahead of each object of ordered requests")
+	fs.IntVar(&c.MaxOrderedObjects, "max-ordered-objects", c.MaxOrderedObjects, "Most objects of an ordered request, which are all read at once")
+	fs.IntVar(&c.BatchSize, "batch-size", c.BatchSize, "Most lines sent in a single result")
+	fs.IntVar(&c.MaxConcurrentRequests, "max-concurrent-requests", c.MaxConcurrentRequests, "Requests served at once before further ones fail with ResourceExhausted; 0 means no limit")
+	fs.StringVar(&c.IndexDir, "index-dir", c.IndexDir, "Directory for checkpoint indexes of gzip objects, built in the background when an object is first read; empty disables indexing")
+	fs.StringVar(&c.MetricsAddress, "metrics-address", c.MetricsAddress, "Address serving metrics at /debug/vars; empty disables them")
+	fs.StringVar(&c.Cache.Dir, "cache-dir", c.Cache.Dir, "Directory caching downloaded GCS objects; empty disables caching")
+	fs.Int64Var(&c.Cache.MaxBytes, "cache-max-bytes", c.Cache.MaxBytes, "Size of the object cache before the least recently used objects are evicted")
+	fs.StringVar(&c.TLS.CertFile, "tls-cert-file", c.TLS.CertFile, "PEM certificate to serve TLS with; empty serves plaintext")
+	fs.StringVar(&c.TLS.KeyFile, "tls-key-file", c.TLS.KeyFile, "PEM private key of --tls-cert-file")
+	fs.StringVar(&c.TLS.ClientCAFile, "tls-client-ca-file", c.TLS.ClientCAFile, "PEM certificates of the CAs client certificates must be signed by; empty accepts clients without certificates")
+	fs.StringVar(&c.Credentials.Mode, "credentials", c.Credentials.Mode, "GCS credentials mode: anonymous, default or service-account")
+	fs.StringVar(&c.Credentials.File, "credentials-file", c.Credentials.File, "Service account JSON key file for the service-account credentials mode")
+}
+
+// parseConfig parses args into the configuration. Flags set in args take
+// precedence over the file named by --config, so args are parsed again
+// once the file is read.
+func parseConfig(fs *flag.FlagSet, args []string) (*serverConfig, error) {
+	config := defaultConfig()
+	config.registerFlags(fs)
+	configFile := fs.String("config", "", "YAML configuration file, overridden by flags set on the command line")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if *configFile != "" {
+		data, err := ioutil.ReadFile(*configFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.UnmarshalStrict(data, config); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", *configFile, err)
+		}
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+	}
+	if len(config.AllowedBuckets) == 0 {
+		config.AllowedBuckets = []string{config.DefaultBucket}
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (c *serverConfig) validate() error {
+	if _, _, err := net.SplitHostPort(c.ListenAddress); err != nil {
+		return fmt.Errorf("bad listen address: %v", err)
+	}
+	if c.DefaultBucket == "" {
+		return fmt.Errorf("a default bucket is required")
+	}
+	if c.LocalRoot != "" && !filepath.IsAbs(c.LocalRoot) {
+		return fmt.Errorf("the local root must be an absolute path")
+	}
+	if c.LineBuffer < 0 || c.OrderedBuffer < 0 {
+		return fmt.Errorf("buffer sizes must not be negative")
+	}
+	if c.MaxOrderedObjects < 1 {
+		return fmt.Errorf("max ordered objects must be positive")
+	}
+	if c.BatchSize < 1 {
+		return fmt.Errorf("batch size must be positive")
+	}
+	if c.MaxConcurrentRequests < 0 {
+		return fmt.Errorf("max concurrent requests must not be negative")
+	}
+	if c.Cache.Dir != "" && c.Cache.MaxBytes <= 0 {
+		return fmt.Errorf("cache max bytes must be positive")
+	}
+	if c.Cache.Dir != "" && c.IndexDir != "" && filepath.Clean(c.Cache.Dir) == filepath.Clean(c.IndexDir) {
+		return fmt.Errorf("the cache and index directories must differ")
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return fmt.Errorf("TLS needs both a certificate and a key file")
+	}
+	if c.TLS.ClientCAFile != "" && c.TLS.CertFile == "" {
+		return fmt.Errorf("client certificates can only be verified with TLS")
+	}
+	switch c.Credentials.Mode {
+	case credentialsAnonymous, credentialsDefault:
+		if c.Credentials.File != "" {
+			return fmt.Errorf("a credentials file is only used by the %s mode", credentialsServiceAccount)
+		}
+	case credentialsServiceAccount:
+		if c.Credentials.File == "" {
+			return fmt.Errorf("the %s mode needs a credentials file", credentialsServiceAccount)
+		}
+	default:
+		return fmt.Errorf("unknown credentials mode %q", c.Credentials.Mode)
+	}
+	return nil
+}
+
+// serverOptions returns the gRPC options for TLS and the request limit.
+func (c *serverConfig) serverOptions() ([]grpc.ServerOption, error) {
+	var options []grpc.ServerOption
+	if c.TLS.CertFile != "" {
+		config, err := c.TLS.load()
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, grpc.Creds(grpccredentials.NewTLS(config)))
+	}
+	if c.MaxConcurrentRequests > 0 {
+		limiter := make(requestLimiter, c.MaxConcurrentRequests)
+		options = append(options, grpc.UnaryInterceptor(limiter.unary), grpc.StreamInterceptor(limiter.stream))
+	}
+	return options, nil
+}
+
+func (c *tlsConfig) load() (*tls.Config, error) {
+	certificate, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the TLS certificate: %v", err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{certificate}}
+	if c.ClientCAFile != "" {
+		data, err := ioutil.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates in %s", c.ClientCAFile)
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// stringList is a comma-separated list flag. Setting it replaces the list.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = nil
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
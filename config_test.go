@@ -0,0 +1,102 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func parseTestConfig(args ...string) (*serverConfig, error) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	return parseConfig(fs, args)
+}
+
+func TestParseConfig(t *testing.T) {
+	path := writeTempFile(t, "config.yaml", []byte(`
+listenAddress: 127.0.0.1:9000
+defaultBucket: scale-tests
+batchSize: 50
+cache:
+  dir: /var/cache/gcsreader
+credentials:
+  mode: default
+`))
+	defer os.RemoveAll(filepath.Dir(path))
+
+	// Flags on the command line win over the file, wherever they are.
+	config, err := parseTestConfig("--batch-size=10", "--config", path, "--cache-max-bytes=1024")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := defaultConfig()
+	expected.ListenAddress = "127.0.0.1:9000"
+	expected.DefaultBucket = "scale-tests"
+	expected.AllowedBuckets = []string{"scale-tests"}
+	expected.BatchSize = 10
+	expected.Cache = cacheConfig{Dir: "/var/cache/gcsreader", MaxBytes: 1024}
+	expected.Credentials.Mode = credentialsDefault
+	if !reflect.DeepEqual(config, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, config)
+	}
+
+	// The dumped configuration reads back the same.
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dumped := writeTempFile(t, "dumped.yaml", data)
+	defer os.RemoveAll(filepath.Dir(dumped))
+	if reread, err := parseTestConfig("--config", dumped); err != nil || !reflect.DeepEqual(reread, config) {
+		t.Fatalf("Expected %+v from %s, got %+v, %v", config, data, reread, err)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	path := writeTempFile(t, "config.yaml", []byte("listenAdress: :9000\n"))
+	defer os.RemoveAll(filepath.Dir(path))
+
+	for _, args := range [][]string{
+		{"--config", path},
+		{"--config", path + ".missing"},
+		{"--listen-address", "17654"},
+		{"--default-bucket", ""},
+		{"--local-root", "logs"},
+		{"--line-buffer", "-1"},
+		{"--max-ordered-objects", "0"},
+		{"--batch-size", "0"},
+		{"--max-concurrent-requests", "-1"},
+		{"--cache-dir", "/tmp", "--cache-max-bytes", "0"},
+		{"--cache-dir", "/tmp/cache", "--index-dir", "/tmp/cache/"},
+		{"--tls-cert-file", "server.crt"},
+		{"--tls-client-ca-file", "ca.crt"},
+		{"--credentials", "service-account"},
+		{"--credentials-file", "key.json"},
+		{"--credentials", "token"},
+	} {
+		if _, err := parseTestConfig(args...); err == nil {
+			t.Errorf("Expected an error for %v", args)
+		}
+	}
+}
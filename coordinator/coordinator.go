@@ -0,0 +1,397 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/kzmrv/gcsreader/internal/common"
+	pb "github.com/kzmrv/gcsreader/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	log "k8s.io/klog"
+)
+
+// workerResolver finds the addresses of the workers to spread a query
+// across.
+type workerResolver interface {
+	resolve(ctx context.Context) ([]string, error)
+}
+
+// staticWorkers is a fixed list of worker addresses.
+type staticWorkers []string
+
+func parseStaticWorkers(addresses string) staticWorkers {
+	var workers staticWorkers
+	for _, address := range strings.Split(addresses, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			workers = append(workers, address)
+		}
+	}
+	return workers
+}
+
+func (w staticWorkers) resolve(context.Context) ([]string, error) {
+	return w, nil
+}
+
+// dnsWorkers looks a name up for every query, so workers can come and go,
+// e.g. behind a headless Kubernetes service.
+type dnsWorkers struct {
+	host, port string
+	lookup     func(ctx context.Context, host string) ([]string, error)
+}
+
+func newDNSWorkers(hostPort string) (*dnsWorkers, error) {
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return nil, err
+	}
+	return &dnsWorkers{host: host, port: port, lookup: net.DefaultResolver.LookupHost}, nil
+}
+
+func (w *dnsWorkers) resolve(ctx context.Context) ([]string, error) {
+	hosts, err := w.lookup(ctx, w.host)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to look up workers: %v", err)
+	}
+	addresses := make([]string, len(hosts))
+	for i, host := range hosts {
+		addresses[i] = net.JoinHostPort(host, w.port)
+	}
+	return addresses, nil
+}
+
+type coordinatorType struct {
+	workers workerResolver
+	// attempts is how many workers a file is tried on.
+	attempts int
+	// filesPerWorker is how many files a worker reads at once.
+	filesPerWorker int
+	dialOptions    []grpc.DialOption
+
+	mu          sync.Mutex
+	connections map[string]*grpc.ClientConn
+	slots       map[string]chan struct{}
+}
+
+func newCoordinator(workers workerResolver, attempts, filesPerWorker int, dialOptions ...grpc.DialOption) *coordinatorType {
+	return &coordinatorType{
+		workers:        workers,
+		attempts:       attempts,
+		filesPerWorker: filesPerWorker,
+		dialOptions:    dialOptions,
+		connections:    map[string]*grpc.ClientConn{},
+		slots:          map[string]chan struct{}{},
+	}
+}
+
+// worker returns a client for address and the semaphore limiting the
+// files it reads at once.
+func (c *coordinatorType) worker(address string) (pb.WorkerClient, chan struct{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	connection, ok := c.connections[address]
+	if !ok {
+		var err error
+		if connection, err = grpc.Dial(address, c.dialOptions...); err != nil {
+			return nil, nil, status.Errorf(codes.Unavailable, "failed to connect to %s: %v", address, err)
+		}
+		c.connections[address] = connection
+		c.slots[address] = make(chan struct{}, c.filesPerWorker)
+	}
+	return pb.NewWorkerClient(connection), c.slots[address], nil
+}
+
+func (c *coordinatorType) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, connection := range c.connections {
+		connection.Close()
+	}
+}
+
+// retryable errors are failures of a worker rather than of the request.
+func retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.Unknown, codes.Internal, codes.Aborted, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
+
+func (c *coordinatorType) Query(request *pb.Work, server pb.Coordinator_QueryServer) error {
+	defer common.TimeTrack(time.Now(), "Query duration")
+	log.Infof("Received: bucket %v, file %v, files %v", request.Bucket, request.File, request.Files)
+	if request.Cursor != nil {
+		return status.Error(codes.InvalidArgument, "cursors are not supported by the coordinator")
+	}
+	if request.Ordered || request.Deduplication != pb.Deduplication_DEDUPLICATION_NONE {
+		// Files are read on different workers, so there is no one place to
+		// merge them by time or group their lines.
+		return status.Error(codes.InvalidArgument, "ordered or deduplicated results are not supported by the coordinator")
+	}
+
+	// Cancelling stops the remaining files when the client goes away,
+	// sending fails, a limit is reached or a file fails.
+	ctx, cancel := context.WithCancel(server.Context())
+	defer cancel()
+	addresses, err := c.workers.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	if len(addresses) == 0 {
+		return status.Error(codes.Unavailable, "no workers available")
+	}
+	files, err := c.expandFiles(ctx, addresses, request)
+	if err != nil {
+		return err
+	}
+	log.Infof("Reading %v files on %v workers", len(files), len(addresses))
+
+	results := make(chan *pb.WorkResult)
+	errs := make(chan error, len(files))
+	var wg sync.WaitGroup
+	for i, file := range files {
+		work := proto.Clone(request).(*pb.Work)
+		work.File, work.Files = file, nil
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Files failing after cancelling only report that.
+			if err := c.readFile(ctx, addresses, i, work, results); err != nil && ctx.Err() == nil {
+				errs <- err
+				cancel()
+			}
+		}(i)
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	summary, err := mergeResults(results, server, request, cancel)
+	if err != nil {
+		return err
+	}
+	select {
+	case fileErr := <-errs:
+		err = fileErr
+	default:
+	}
+	if err == nil && server.Context().Err() != nil {
+		err = status.FromContextError(server.Context().Err()).Err()
+	}
+	if err != nil {
+		st := status.Convert(err)
+		summary.Code = int32(st.Code())
+		summary.Error = st.Message()
+	}
+	if sendErr := server.Send(&pb.WorkResult{Summary: summary}); sendErr != nil {
+		return sendErr
+	}
+	return err
+}
+
+// mergeResults forwards lines of all files to the client until results is
+// closed, enforcing the limits of request across files, and adds up the
+// summaries of the files.
+func mergeResults(results chan *pb.WorkResult, server pb.Coordinator_QueryServer, request *pb.Work, cancel func()) (*pb.WorkSummary, error) {
+	summary := &pb.WorkSummary{}
+	var lines, bytes int64
+	var sendErr error
+	for result := range results {
+		if result.Summary != nil {
+			addSummary(summary, result.Summary)
+		}
+		if sendErr != nil || summary.LimitReached || len(result.LogLines)+len(result.MalformedLines) == 0 {
+			// Keep draining, so readers blocked on sending can stop.
+			continue
+		}
+		for i, line := range result.LogLines {
+			lines++
+			bytes += int64(len(line.Entry) + len(line.Projection))
+			if (request.MaxLines > 0 && lines > request.MaxLines) || (request.MaxBytes > 0 && bytes > request.MaxBytes) {
+				result.LogLines = result.LogLines[:i]
+				summary.LimitReached = true
+				cancel()
+				break
+			}
+		}
+		if sendErr = server.Send(&pb.WorkResult{LogLines: result.LogLines, MalformedLines: result.MalformedLines}); sendErr != nil {
+			log.Errorf("Failed to send results with: %v", sendErr)
+			cancel()
+		}
+	}
+	return summary, sendErr
+}
+
+func addSummary(total, summary *pb.WorkSummary) {
+	total.MalformedLines += summary.MalformedLines
+	total.TruncatedLines += summary.TruncatedLines
+	total.SkippedLines += summary.SkippedLines
+	total.BytesRead += summary.BytesRead
+	total.LinesScanned += summary.LinesScanned
+	total.LinesMatched += summary.LinesMatched
+	total.LimitReached = total.LimitReached || summary.LimitReached
+}
+
+// readFile reads a single file on the workers, starting on the one picked
+// by index. A worker failing part way through is replaced by the next
+// one, which resumes after the last result received.
+func (c *coordinatorType) readFile(ctx context.Context, addresses []string, index int, work *pb.Work, results chan *pb.WorkResult) error {
+	var err error
+	// partial adds up the summaries of failed attempts. Each resumes where
+	// the previous one stopped, so no line is counted twice.
+	partial := &pb.WorkSummary{}
+	for attempt := 0; attempt < c.attempts; attempt++ {
+		address := addresses[(index+attempt)%len(addresses)]
+		var summary *pb.WorkSummary
+		summary, err = c.readFileOn(ctx, address, work, results)
+		if summary != nil {
+			addSummary(partial, summary)
+		}
+		if err != nil && retryable(err) && ctx.Err() == nil {
+			log.Warningf("Reading %v on %v failed, attempt %v of %v: %v", work.File, address, attempt+1, c.attempts, err)
+			continue
+		}
+		break
+	}
+	select {
+	case results <- &pb.WorkResult{Summary: partial}:
+	case <-ctx.Done():
+	}
+	return err
+}
+
+// readFileOn forwards the lines of work read on address to results and
+// returns the summary of the read, which is held back until it ends.
+func (c *coordinatorType) readFileOn(ctx context.Context, address string, work *pb.Work, results chan *pb.WorkResult) (*pb.WorkSummary, error) {
+	client, slots, err := c.worker(address)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	defer func() { <-slots }()
+
+	stream, err := client.DoWork(ctx, work)
+	if err != nil {
+		return nil, err
+	}
+	var summary *pb.WorkSummary
+	for {
+		result, err := stream.Recv()
+		if err == io.EOF {
+			return summary, nil
+		}
+		if err != nil {
+			return summary, err
+		}
+		if result.Cursor != nil {
+			work.Cursor = result.Cursor
+		}
+		if result.Summary != nil {
+			summary, result.Summary = result.Summary, nil
+		}
+		select {
+		case results <- result:
+		case <-ctx.Done():
+			return summary, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+// expandFiles lists the objects matching the prefixes and patterns of
+// request on a worker, so they can be read on different ones.
+func (c *coordinatorType) expandFiles(ctx context.Context, addresses []string, request *pb.Work) ([]string, error) {
+	paths := request.Files
+	if request.File != "" {
+		paths = append([]string{request.File}, paths...)
+	}
+	if len(paths) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no files requested")
+	}
+
+	var files []string
+	seen := map[string]bool{}
+	for _, path := range paths {
+		object, member := path, ""
+		if i := strings.Index(path, "#"); i != -1 {
+			object, member = path[:i], path[i:]
+		}
+		names := []string{object}
+		if common.IsObjectPattern(object) {
+			listed, err := c.listFiles(ctx, addresses, &pb.ListFilesRequest{Bucket: request.Bucket, Prefix: object})
+			if err != nil {
+				return nil, err
+			}
+			if len(listed) == 0 {
+				return nil, status.Errorf(codes.NotFound, "no objects match %s", path)
+			}
+			// Workers list GCS objects by name, which refers to the same
+			// object only in the bucket of the request.
+			if strings.HasPrefix(object, "gs://") {
+				bucket := strings.SplitN(strings.TrimPrefix(object, "gs://"), "/", 2)[0]
+				for i, name := range listed {
+					listed[i] = "gs://" + bucket + "/" + name
+				}
+			}
+			names = listed
+		}
+		for _, name := range names {
+			if !seen[name+member] {
+				seen[name+member] = true
+				files = append(files, name+member)
+			}
+		}
+	}
+	return files, nil
+}
+
+func (c *coordinatorType) listFiles(ctx context.Context, addresses []string, request *pb.ListFilesRequest) ([]string, error) {
+	var err error
+	for attempt := 0; attempt < c.attempts; attempt++ {
+		address := addresses[attempt%len(addresses)]
+		var client pb.WorkerClient
+		if client, _, err = c.worker(address); err == nil {
+			var result *pb.ListFilesResult
+			if result, err = client.ListFiles(ctx, request); err == nil {
+				names := make([]string, len(result.Files))
+				for i, file := range result.Files {
+					names[i] = file.Name
+				}
+				return names, nil
+			}
+		}
+		if !retryable(err) {
+			return nil, err
+		}
+		log.Warningf("Listing %v on %v failed: %v", request.Prefix, address, err)
+	}
+	return nil, err
+}
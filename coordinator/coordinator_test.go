@@ -0,0 +1,321 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	pb "github.com/kzmrv/gcsreader/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+var testFiles = map[string][]string{
+	"logs/a.log": {"a1", "a2", "a3"},
+	"logs/b.log": {"b1", "b2"},
+	"logs/c.log": {"c1"},
+	"other.log":  {"o1", "o2"},
+	// Objects in other buckets are named by URI.
+	"gs://other-bucket/logs/d.log": {"d1"},
+}
+
+func TestQueryMergesFiles(t *testing.T) {
+	workers := startWorkers(t, &fakeWorker{}, &fakeWorker{})
+	results, err := query(t, workers, &pb.Work{File: "logs/", Files: []string{"other.log", "logs/a.log"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLines(t, results, "a1", "a2", "a3", "b1", "b2", "c1", "o1", "o2")
+	summary := results[len(results)-1].Summary
+	if summary.LinesMatched != 8 || summary.Code != 0 {
+		t.Fatalf("Unexpected summary %v", summary)
+	}
+}
+
+func TestQueryExpandsPatternsInOtherBuckets(t *testing.T) {
+	workers := startWorkers(t, &fakeWorker{})
+	results, err := query(t, workers, &pb.Work{Files: []string{"gs://other-bucket/logs/*", "logs/c.log"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLines(t, results, "c1", "d1")
+}
+
+func TestQueryRetriesOnOtherWorker(t *testing.T) {
+	failing := &fakeWorker{failAfter: 1}
+	healthy := &fakeWorker{}
+	workers := startWorkers(t, failing, healthy)
+	results, err := query(t, workers, &pb.Work{Files: []string{"logs/a.log", "logs/b.log"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The failing worker returns the first line of its file and the
+	// healthy one the rest.
+	expectLines(t, results, "a1", "a2", "a3", "b1", "b2")
+	if cursors := healthy.resumedFrom(); len(cursors) != 1 || cursors[0].LineNumber != 1 {
+		t.Fatalf("Expected a read resumed after the first line, got %v", cursors)
+	}
+	// The failed read is counted up to where it stopped.
+	if summary := results[len(results)-1].Summary; summary.LinesMatched != 5 || summary.Code != 0 {
+		t.Fatalf("Unexpected summary %v", summary)
+	}
+}
+
+func TestQueryFailsOnRequestErrors(t *testing.T) {
+	workers := startWorkers(t, &fakeWorker{}, &fakeWorker{})
+	results, err := query(t, workers, &pb.Work{Files: []string{"logs/a.log", "missing.log"}})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("Expected NotFound, got %v", err)
+	}
+	if summary := results[len(results)-1].Summary; summary.Code != int32(codes.NotFound) {
+		t.Fatalf("Expected the error in the summary, got %v", summary)
+	}
+
+	// Workers failing every attempt fail the query too.
+	workers = startWorkers(t, &fakeWorker{failAfter: 1}, &fakeWorker{failAfter: 1})
+	if _, err := query(t, workers, &pb.Work{File: "logs/a.log"}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Expected Unavailable, got %v", err)
+	}
+}
+
+func TestQueryLimits(t *testing.T) {
+	workers := startWorkers(t, &fakeWorker{}, &fakeWorker{})
+	results, err := query(t, workers, &pb.Work{File: "logs/", MaxLines: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := 0
+	for _, result := range results {
+		lines += len(result.LogLines)
+	}
+	if summary := results[len(results)-1].Summary; lines != 4 || !summary.LimitReached {
+		t.Fatalf("Expected 4 lines and the limit reached, got %v lines and %v", lines, summary)
+	}
+}
+
+func TestQueryBadRequest(t *testing.T) {
+	workers := startWorkers(t, &fakeWorker{})
+	for _, request := range []*pb.Work{
+		{},
+		{File: "logs/a.log", Cursor: &pb.Cursor{Source: "logs/a.log"}},
+		{File: "logs/a.log", Ordered: true},
+		{File: "logs/a.log", Deduplication: pb.Deduplication_DEDUPLICATION_LATEST_STAGE},
+	} {
+		if _, err := query(t, workers, request); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument for %v, got %v", request, err)
+		}
+	}
+}
+
+func TestDNSWorkers(t *testing.T) {
+	resolver, err := newDNSWorkers("workers:17654")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver.lookup = func(_ context.Context, host string) ([]string, error) {
+		return []string{"10.0.0.1", "10.0.0.2"}, nil
+	}
+	addresses, err := resolver.resolve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"10.0.0.1:17654", "10.0.0.2:17654"}; !reflect.DeepEqual(addresses, expected) {
+		t.Fatalf("Expected %v, got %v", expected, addresses)
+	}
+	if _, err := newDNSWorkers("workers"); err == nil {
+		t.Fatal("Expected an error without a port")
+	}
+}
+
+func TestWorkerTLSConfigErrors(t *testing.T) {
+	notPEM, err := ioutil.TempFile("", "ca.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(notPEM.Name())
+	notPEM.Close()
+
+	if _, err := (&workerTLSConfig{}).dialOption(); err != nil {
+		t.Fatalf("Expected plaintext without TLS settings, got %v", err)
+	}
+	for _, config := range []*workerTLSConfig{
+		{certFile: "client.crt"},
+		{keyFile: "client.key"},
+		{caFile: notPEM.Name() + ".missing"},
+		{caFile: notPEM.Name()},
+		{certFile: notPEM.Name(), keyFile: notPEM.Name()},
+	} {
+		if _, err := config.dialOption(); err == nil {
+			t.Errorf("Expected an error for %+v", config)
+		}
+	}
+}
+
+// fakeWorker serves testFiles a line per result, with the line number as
+// cursor.
+type fakeWorker struct {
+	pb.UnimplementedWorkerServer
+	// failAfter makes every read fail after this many lines.
+	failAfter int
+
+	mu      sync.Mutex
+	cursors []*pb.Cursor
+}
+
+func (w *fakeWorker) DoWork(request *pb.Work, server pb.Worker_DoWorkServer) error {
+	lines, ok := testFiles[request.File]
+	if !ok {
+		return status.Errorf(codes.NotFound, "%s not found", request.File)
+	}
+	start := 0
+	if request.Cursor != nil {
+		start = int(request.Cursor.LineNumber)
+		w.mu.Lock()
+		w.cursors = append(w.cursors, request.Cursor)
+		w.mu.Unlock()
+	}
+	matched := 0
+	for i := start; i < len(lines); i++ {
+		if w.failAfter > 0 && matched == w.failAfter {
+			// Like workers, failed reads end with a summary too.
+			err := status.Error(codes.Unavailable, "worker is going away")
+			server.Send(&pb.WorkResult{Summary: &pb.WorkSummary{LinesMatched: int64(matched), Code: int32(codes.Unavailable)}})
+			return err
+		}
+		if request.MaxLines > 0 && int64(matched) == request.MaxLines {
+			return server.Send(&pb.WorkResult{Summary: &pb.WorkSummary{LinesMatched: int64(matched), LimitReached: true}})
+		}
+		matched++
+		err := server.Send(&pb.WorkResult{
+			LogLines: []*pb.LogLine{{Entry: lines[i], Source: request.File}},
+			Cursor:   &pb.Cursor{Source: request.File, LineNumber: int64(i + 1)},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return server.Send(&pb.WorkResult{Summary: &pb.WorkSummary{LinesMatched: int64(matched)}})
+}
+
+// ListFiles names objects without their bucket, like workers do.
+func (w *fakeWorker) ListFiles(_ context.Context, request *pb.ListFilesRequest) (*pb.ListFilesResult, error) {
+	bucket, prefix := splitBucket(request.Prefix)
+	prefix = strings.TrimRight(prefix, "*")
+	result := &pb.ListFilesResult{}
+	for file := range testFiles {
+		if objectBucket, name := splitBucket(file); objectBucket == bucket && strings.HasPrefix(name, prefix) {
+			result.Files = append(result.Files, &pb.FileInfo{Name: name})
+		}
+	}
+	return result, nil
+}
+
+// splitBucket splits gs:// URIs into their bucket and object name.
+func splitBucket(path string) (string, string) {
+	if !strings.HasPrefix(path, "gs://") {
+		return "", path
+	}
+	parts := strings.SplitN(strings.TrimPrefix(path, "gs://"), "/", 2)
+	return parts[0], parts[1]
+}
+
+func (w *fakeWorker) resumedFrom() []*pb.Cursor {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.cursors
+}
+
+// startWorkers serves workers on local ports until the test ends.
+func startWorkers(t *testing.T, workers ...pb.WorkerServer) staticWorkers {
+	var addresses staticWorkers
+	for _, worker := range workers {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := grpc.NewServer()
+		pb.RegisterWorkerServer(server, worker)
+		go server.Serve(listener)
+		t.Cleanup(server.Stop)
+		addresses = append(addresses, listener.Addr().String())
+	}
+	return addresses
+}
+
+// query runs a Query on a coordinator over workers and returns the results
+// received before it ended.
+func query(t *testing.T, workers workerResolver, request *pb.Work) ([]*pb.WorkResult, error) {
+	credentials := grpc.WithTransportCredentials(insecure.NewCredentials())
+	coordinator := newCoordinator(workers, 2, 2, credentials)
+	defer coordinator.close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	pb.RegisterCoordinatorServer(server, coordinator)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	connection, err := grpc.Dial(listener.Addr().String(), credentials)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer connection.Close()
+	stream, err := pb.NewCoordinatorClient(connection).Query(context.Background(), request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []*pb.WorkResult
+	for {
+		result, err := stream.Recv()
+		if err == io.EOF {
+			return results, nil
+		}
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+}
+
+func expectLines(t *testing.T, results []*pb.WorkResult, expected ...string) {
+	var lines []string
+	for _, result := range results {
+		for _, line := range result.LogLines {
+			lines = append(lines, line.Entry)
+		}
+	}
+	sort.Strings(lines)
+	if !reflect.DeepEqual(lines, expected) {
+		t.Fatalf("Expected lines %v, got %v", expected, lines)
+	}
+	if results[len(results)-1].Summary == nil {
+		t.Fatalf("Expected a summary last, got %v", results[len(results)-1])
+	}
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// The coordinator serves Query requests by spreading their files across
+// a pool of gcsreader workers.
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+
+	pb "github.com/kzmrv/gcsreader/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	log "k8s.io/klog"
+)
+
+var (
+	listenAddress  = flag.String("listen-address", ":17655", "Address to serve gRPC on")
+	workers        = flag.String("workers", "", "Comma-separated list of worker addresses")
+	workersDNS     = flag.String("workers-dns", "", "Name and port resolving to the worker addresses, e.g. gcsreader-workers:17654, used instead of --workers")
+	attempts       = flag.Int("attempts", 3, "Number of workers a file is tried on before the query fails")
+	filesPerWorker = flag.Int("files-per-worker", 4, "Number of files a worker reads at once")
+
+	workerTLS        = flag.Bool("worker-tls", false, "Connect to workers over TLS, verifying them with the system CAs unless --worker-ca-file is set")
+	workerCAFile     = flag.String("worker-ca-file", "", "PEM certificates of the CAs worker certificates must be signed by; implies --worker-tls")
+	workerServerName = flag.String("worker-server-name", "", "Name worker certificates are verified against instead of their address, e.g. when resolved with --workers-dns")
+	workerCertFile   = flag.String("worker-cert-file", "", "PEM client certificate presented to workers that require one; implies --worker-tls")
+	workerKeyFile    = flag.String("worker-key-file", "", "PEM private key of --worker-cert-file")
+)
+
+// workerTLSConfig configures how workers are connected to.
+type workerTLSConfig struct {
+	enabled    bool
+	caFile     string
+	serverName string
+	certFile   string
+	keyFile    string
+}
+
+// dialOption returns the transport credentials to dial workers with,
+// plaintext unless TLS is enabled or any of its files is set.
+func (c *workerTLSConfig) dialOption() (grpc.DialOption, error) {
+	if !c.enabled && c.caFile == "" && c.certFile == "" && c.keyFile == "" {
+		return grpc.WithTransportCredentials(insecure.NewCredentials()), nil
+	}
+	if (c.certFile == "") != (c.keyFile == "") {
+		return nil, fmt.Errorf("a client certificate needs both a certificate and a key file")
+	}
+	config := &tls.Config{ServerName: c.serverName}
+	if c.caFile != "" {
+		data, err := ioutil.ReadFile(c.caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates in %s", c.caFile)
+		}
+	}
+	if c.certFile != "" {
+		certificate, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	return grpc.WithTransportCredentials(credentials.NewTLS(config)), nil
+}
+
+func main() {
+	log.InitFlags(nil)
+	flag.Parse()
+
+	var resolver workerResolver
+	switch {
+	case *workersDNS != "":
+		dns, err := newDNSWorkers(*workersDNS)
+		if err != nil {
+			log.Fatalf("Bad --workers-dns: %v", err)
+		}
+		resolver = dns
+	case *workers != "":
+		resolver = parseStaticWorkers(*workers)
+	default:
+		log.Fatal("Either --workers or --workers-dns is required")
+	}
+	if *attempts < 1 || *filesPerWorker < 1 {
+		log.Fatal("--attempts and --files-per-worker must be positive")
+	}
+
+	workerCredentials, err := (&workerTLSConfig{
+		enabled:    *workerTLS,
+		caFile:     *workerCAFile,
+		serverName: *workerServerName,
+		certFile:   *workerCertFile,
+		keyFile:    *workerKeyFile,
+	}).dialOption()
+	if err != nil {
+		log.Fatalf("Bad worker TLS configuration: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", *listenAddress)
+	if err != nil {
+		log.Fatalf("Failed to listen: %v", err)
+	}
+	coordinator := newCoordinator(resolver, *attempts, *filesPerWorker, workerCredentials)
+	defer coordinator.close()
+
+	log.Infof("Listening on: %v", *listenAddress)
+	server := grpc.NewServer()
+	pb.RegisterCoordinatorServer(server, coordinator)
+	if err := server.Serve(listener); err != nil {
+		log.Fatalf("Failed to serve: %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"net/url"
+
+	pb "github.com/kzmrv/gcsreader/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// resumeCursor skips what an earlier stream of the same request already
+// returned: every source before the cursor source, and the lines of the
+// cursor source up to its position. Sources are visited in request order
+// by a single goroutine.
+type resumeCursor struct {
+	source   string
+	object   string
+	position linePosition
+	reached  bool
+}
+
+func newResumeCursor(cursor *pb.Cursor) (*resumeCursor, error) {
+	if cursor == nil {
+		return nil, nil
+	}
+	if cursor.Offset < 0 || cursor.LineNumber < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "bad cursor position %v", cursor)
+	}
+	location, err := url.Parse(cursor.Source)
+	if err != nil || cursor.Source == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "bad cursor source %q", cursor.Source)
+	}
+	return &resumeCursor{
+		source:   cursor.Source,
+		object:   objectKey(location),
+		position: linePosition{offset: cursor.Offset, lineNumber: cursor.LineNumber},
+	}, nil
+}
+
+// skipObject reports whether the whole object at location comes before
+// the cursor.
+func (c *resumeCursor) skipObject(location *url.URL) bool {
+	return c != nil && !c.reached && objectKey(location) != c.object
+}
+
+// start returns where reading source begins, or false when the whole
+// source comes before the cursor.
+func (c *resumeCursor) start(source string) (linePosition, bool) {
+	if c == nil || c.reached {
+		return linePosition{}, true
+	}
+	if source != c.source {
+		return linePosition{}, false
+	}
+	c.reached = true
+	return c.position, true
+}
+
+// check fails when the cursor source was not among the sources read, for
+// example because the objects changed since the cursor was returned.
+func (c *resumeCursor) check() error {
+	if c != nil && !c.reached {
+		return status.Errorf(codes.FailedPrecondition, "cursor source %s was not found", c.source)
+	}
+	return nil
+}
+
+// skipTo discards the uncompressed content of a source read from from,
+// up to start.
+func skipTo(reader io.Reader, from, start linePosition) error {
+	skipped, err := io.CopyN(ioutil.Discard, reader, start.offset-from.offset)
+	if err == io.EOF {
+		return status.Errorf(codes.FailedPrecondition, "source ends at %d, before the cursor offset %d", from.offset+skipped, start.offset)
+	}
+	return err
+}
+
+// objectKey identifies the object of a location, without archive members.
+func objectKey(location *url.URL) string {
+	object := *location
+	object.Fragment = ""
+	return object.String()
+}
+
+func (p linePosition) cursor(source string) *pb.Cursor {
+	return &pb.Cursor{Source: source, Offset: p.offset, LineNumber: p.lineNumber}
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	pb "github.com/kzmrv/gcsreader/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDoWorkResume(t *testing.T) {
+	dir := filepath.Dir(writeTempFile(t, "a.log.gz", gzipped(t, line1+"\n"+line2+"\n")))
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "b.log"), []byte(line3+"\nnot json\n"+line2+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	work := func() *pb.Work {
+		return &pb.Work{Files: []string{"file://" + dir + "/"}, ErrorPolicy: pb.ErrorPolicy_ERROR_POLICY_REPORT}
+	}
+
+	all := &fakeWorkStream{ctx: context.Background()}
+	if err := newTestServer(nil).DoWork(work(), all); err != nil {
+		t.Fatal(err)
+	}
+	expected := all.lines()
+	if len(expected) != 4 {
+		t.Fatalf("Expected 4 lines, got %v", len(expected))
+	}
+
+	// Break the stream after each line and resume from its cursor.
+	for i := range expected {
+		broken := &fakeWorkStream{ctx: context.Background()}
+		request := work()
+		request.MaxLines = int64(i + 1)
+		if err := newTestServer(nil).DoWork(request, broken); err != nil {
+			t.Fatal(err)
+		}
+		cursor := broken.results[len(broken.results)-1].Cursor
+
+		resumed := &fakeWorkStream{ctx: context.Background()}
+		request = work()
+		request.Cursor = cursor
+		if err := newTestServer(nil).DoWork(request, resumed); err != nil {
+			t.Fatalf("Resuming from %v: %v", cursor, err)
+		}
+		lines := resumed.lines()
+		if len(lines) != len(expected)-i-1 {
+			t.Fatalf("Resuming from %v: expected %v lines, got %v", cursor, len(expected)-i-1, len(lines))
+		}
+		for j, line := range lines {
+			if want := expected[i+1+j]; line.Entry != want.Entry || line.Source != want.Source {
+				t.Errorf("Resuming from %v: expected line %v from %s, got one from %s", cursor, i+1+j, want.Source, line.Source)
+			}
+		}
+	}
+
+	// The malformed line between the last two lines is not reported again.
+	resumed := &fakeWorkStream{ctx: context.Background()}
+	request := work()
+	request.Cursor = &pb.Cursor{Source: "file://" + dir + "/b.log", Offset: int64(len(line3) + 10), LineNumber: 2}
+	if err := newTestServer(nil).DoWork(request, resumed); err != nil {
+		t.Fatal(err)
+	}
+	if summary := resumed.results[len(resumed.results)-1].Summary; summary.GetMalformedLines() != 0 || len(resumed.lines()) != 1 {
+		t.Fatalf("Unexpected resumed results %v", resumed.results)
+	}
+}
+
+func TestDoWorkResumeRandomSample(t *testing.T) {
+	path := writeTempFile(t, "audit.log", []byte(strings.Repeat(line2+"\n", 200)))
+	defer os.RemoveAll(filepath.Dir(path))
+	work := func() *pb.Work {
+		return &pb.Work{File: "file://" + path, Sampling: &pb.Sampling{Mode: pb.SamplingMode_SAMPLING_RANDOM, Rate: 0.3, Seed: 5}}
+	}
+	positions := func(stream *fakeWorkStream) []int64 {
+		var numbers []int64
+		for _, result := range stream.results {
+			if len(result.LogLines) != 0 {
+				numbers = append(numbers, result.Cursor.LineNumber)
+			}
+		}
+		return numbers
+	}
+
+	// A line per result gives a cursor for every sampled line.
+	s := newTestServer(nil)
+	s.batchSize = 1
+	all := &fakeWorkStream{ctx: context.Background()}
+	if err := s.DoWork(work(), all); err != nil {
+		t.Fatal(err)
+	}
+	expected := positions(all)
+	if len(expected) < 20 {
+		t.Fatalf("Expected about 60 sampled lines, got %v", len(expected))
+	}
+
+	// Resuming half way returns the rest of the same sample.
+	resumed := &fakeWorkStream{ctx: context.Background()}
+	request := work()
+	request.Cursor = &pb.Cursor{Source: "file://" + path, Offset: 100 * int64(len(line2)+1), LineNumber: 100}
+	if err := s.DoWork(request, resumed); err != nil {
+		t.Fatal(err)
+	}
+	var rest []int64
+	for _, number := range expected {
+		if number > 100 {
+			rest = append(rest, number)
+		}
+	}
+	if got := positions(resumed); !reflect.DeepEqual(got, rest) {
+		t.Fatalf("Expected lines %v after resuming, got %v", rest, got)
+	}
+}
+
+func TestDoWorkBadCursor(t *testing.T) {
+	path := writeTempFile(t, "audit.log", []byte(line1+"\n"))
+	defer os.RemoveAll(filepath.Dir(path))
+
+	for _, test := range []struct {
+		cursor   *pb.Cursor
+		expected codes.Code
+	}{
+		{&pb.Cursor{Source: "file://" + path, Offset: -1}, codes.InvalidArgument},
+		{&pb.Cursor{Source: "file:///elsewhere/audit.log"}, codes.FailedPrecondition},
+		{&pb.Cursor{Source: "file://" + path, Offset: int64(len(line1) + 100)}, codes.FailedPrecondition},
+	} {
+		stream := &fakeWorkStream{ctx: context.Background()}
+		err := newTestServer(nil).DoWork(&pb.Work{File: "file://" + path, Cursor: test.cursor}, stream)
+		if status.Code(err) != test.expected {
+			t.Errorf("%v: expected %v, got %v", test.cursor, test.expected, err)
+		}
+	}
+}
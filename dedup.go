@@ -0,0 +1,264 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"container/list"
+	"context"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	ts "github.com/golang/protobuf/ptypes/timestamp"
+	pb "github.com/kzmrv/gcsreader/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Audit event stages, in the order a request goes through them.
+const (
+	stageRequestReceived  = "RequestReceived"
+	stageResponseStarted  = "ResponseStarted"
+	stageResponseComplete = "ResponseComplete"
+	stagePanic            = "Panic"
+)
+
+// stageRanks orders stages, unknown ones come first. A request ends with
+// either ResponseComplete or Panic.
+var stageRanks = map[string]int{
+	stageRequestReceived:  1,
+	stageResponseStarted:  2,
+	stageResponseComplete: 3,
+	stagePanic:            3,
+}
+
+const finalStageRank = 3
+
+const (
+	defaultDeduplicationWindow = 10 * time.Minute
+	maxDeduplicationWindow     = 24 * time.Hour
+)
+
+// deduplicator groups lines by auditID. The lines of a request are held
+// back until its final stage is read, and only the line of its latest
+// stage is returned, so lines come in the order requests finish. IDs of
+// finished requests are kept, so copies read later, e.g. from the log of
+// another replica, are left out too.
+//
+// Both are bounded by a window over the newest line time read, like the
+// reorder window of ordered requests: requests unfinished once lines the
+// window newer are read, e.g. long watches, are returned with their
+// latest stage so far, and finished IDs are forgotten.
+type deduplicator struct {
+	combined bool
+	window   time.Duration
+	newest   time.Time
+	// pending holds the elements of order by auditID.
+	pending map[string]*list.Element
+	// order holds the unfinished requests as *requestGroup, by their first
+	// line.
+	order *list.List
+	// finished holds the elements of finishedOrder by auditID.
+	finished map[string]*list.Element
+	// finishedOrder holds the finished requests as *finishedRequest, by
+	// when they finished.
+	finishedOrder *list.List
+}
+
+// requestGroup and finishedRequest record newest at the time they were
+// added, so both lists are in time order as well.
+type requestGroup struct {
+	auditID string
+	latest  *logEntry
+	stages  *requestStages
+	added   time.Time
+}
+
+type finishedRequest struct {
+	auditID  string
+	finished time.Time
+}
+
+// newDeduplicator returns nil when the request keeps all lines.
+func newDeduplicator(request *pb.Work) (*deduplicator, error) {
+	switch request.Deduplication {
+	case pb.Deduplication_DEDUPLICATION_NONE:
+		return nil, nil
+	case pb.Deduplication_DEDUPLICATION_LATEST_STAGE, pb.Deduplication_DEDUPLICATION_COMBINED:
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown deduplication %v", request.Deduplication)
+	}
+	if request.Cursor != nil {
+		return nil, status.Error(codes.InvalidArgument, "deduplicated results cannot be resumed from a cursor")
+	}
+	window := defaultDeduplicationWindow
+	if request.DeduplicationWindow != nil {
+		var err error
+		window, err = ptypes.Duration(request.DeduplicationWindow)
+		if err != nil || window < 0 || window > maxDeduplicationWindow {
+			return nil, status.Errorf(codes.InvalidArgument, "deduplication window must be between 0 and %v", maxDeduplicationWindow)
+		}
+	}
+	return &deduplicator{
+		combined:      request.Deduplication == pb.Deduplication_DEDUPLICATION_COMBINED,
+		window:        window,
+		pending:       map[string]*list.Element{},
+		order:         list.New(),
+		finished:      map[string]*list.Element{},
+		finishedOrder: list.New(),
+	}, nil
+}
+
+// run deduplicates the lines from in into out and closes out once in is
+// closed. Other entries are passed on as they come.
+func (d *deduplicator) run(ctx context.Context, in <-chan *lineEntry, out chan *lineEntry) {
+	defer close(out)
+	for entry := range in {
+		entries := []*lineEntry{entry}
+		if entry.logEntry != nil {
+			entries = d.add(entry.logEntry)
+		}
+		for _, entry := range entries {
+			if sendLine(ctx, out, entry) != nil {
+				return
+			}
+		}
+	}
+	for d.order.Len() > 0 {
+		if sendLine(ctx, out, d.release(d.order.Front())) != nil {
+			return
+		}
+	}
+}
+
+// add returns the lines that are known to be duplicates or complete once
+// entry is read.
+func (d *deduplicator) add(entry *logEntry) []*lineEntry {
+	if entry.time.After(d.newest) {
+		d.newest = *entry.time
+	}
+	entries := d.expire()
+	auditID := entry.event.AuditID
+	if auditID == "" {
+		return append(entries, &lineEntry{logEntry: entry})
+	}
+	if _, ok := d.finished[auditID]; ok {
+		entry.duplicate = true
+		return append(entries, &lineEntry{logEntry: entry})
+	}
+
+	element, ok := d.pending[auditID]
+	if !ok {
+		element = d.order.PushBack(&requestGroup{auditID: auditID, stages: &requestStages{}, added: d.newest})
+		d.pending[auditID] = element
+	}
+	group := element.Value.(*requestGroup)
+	group.stages.add(entry.event)
+
+	rank := stageRanks[entry.event.Stage]
+	if group.latest == nil || rank > stageRanks[group.latest.event.Stage] {
+		if group.latest != nil {
+			group.latest.duplicate = true
+			entries = append(entries, &lineEntry{logEntry: group.latest})
+		}
+		group.latest = entry
+	} else {
+		// Of lines of the same stage, the first one read is kept.
+		entry.duplicate = true
+		entries = append(entries, &lineEntry{logEntry: entry})
+	}
+	if rank == finalStageRank {
+		entries = append(entries, d.release(element))
+	}
+	return entries
+}
+
+// expire releases the requests unfinished for longer than the window and
+// forgets the ones finished before it.
+func (d *deduplicator) expire() []*lineEntry {
+	cutoff := d.newest.Add(-d.window)
+	for front := d.finishedOrder.Front(); front != nil && front.Value.(*finishedRequest).finished.Before(cutoff); front = d.finishedOrder.Front() {
+		delete(d.finished, d.finishedOrder.Remove(front).(*finishedRequest).auditID)
+	}
+	var entries []*lineEntry
+	for front := d.order.Front(); front != nil && front.Value.(*requestGroup).added.Before(cutoff); front = d.order.Front() {
+		entries = append(entries, d.release(front))
+	}
+	return entries
+}
+
+// release removes a request and returns its line to send. Later lines of
+// the request are left out as copies.
+func (d *deduplicator) release(element *list.Element) *lineEntry {
+	group := d.order.Remove(element).(*requestGroup)
+	delete(d.pending, group.auditID)
+	d.finished[group.auditID] = d.finishedOrder.PushBack(&finishedRequest{auditID: group.auditID, finished: d.newest})
+	if d.combined {
+		group.latest.stages = group.stages
+	}
+	return &lineEntry{logEntry: group.latest}
+}
+
+// requestStages collects when a request reached each of its stages.
+type requestStages struct {
+	received time.Time
+	// times holds the stage timestamps by stage name.
+	times map[string]time.Time
+}
+
+func (s *requestStages) add(event *auditEvent) {
+	if s.received.IsZero() {
+		s.received = event.receivedTimestamp()
+	}
+	if event.StageTimestamp.IsZero() {
+		return
+	}
+	if s.times == nil {
+		s.times = map[string]time.Time{}
+	}
+	if _, ok := s.times[event.Stage]; !ok {
+		s.times[event.Stage] = event.StageTimestamp
+	}
+}
+
+func (s *requestStages) proto() *pb.Stages {
+	stages := &pb.Stages{
+		RequestReceived:  s.timestamp(stageRequestReceived),
+		ResponseStarted:  s.timestamp(stageResponseStarted),
+		ResponseComplete: s.timestamp(stageResponseComplete),
+		Panic:            s.timestamp(stagePanic),
+	}
+	if started, ok := s.times[stageResponseStarted]; ok {
+		stages.TimeToFirstByte = ptypes.DurationProto(started.Sub(s.received))
+	}
+	end, ok := s.times[stageResponseComplete]
+	if !ok {
+		end, ok = s.times[stagePanic]
+	}
+	if ok {
+		stages.Duration = ptypes.DurationProto(end.Sub(s.received))
+	}
+	return stages
+}
+
+func (s *requestStages) timestamp(stage string) *ts.Timestamp {
+	t, ok := s.times[stage]
+	if !ok {
+		return nil
+	}
+	timestamp, _ := ptypes.TimestampProto(t)
+	return timestamp
+}
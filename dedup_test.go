@@ -0,0 +1,189 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/duration"
+	pb "github.com/kzmrv/gcsreader/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// stageEvent returns an audit line of a request received and reaching
+// stage at the given offsets in seconds from auditLogStart.
+func stageEvent(auditID, stage string, received, reached float64) string {
+	at := func(offset float64) string {
+		return auditLogStart.Add(time.Duration(offset * float64(time.Second))).Format(time.RFC3339Nano)
+	}
+	return fmt.Sprintf(`{"kind":"Event","apiVersion":"audit.k8s.io/v1","auditID":"%s","stage":"%s","verb":"watch","requestReceivedTimestamp":"%s","stageTimestamp":"%s"}`+"\n",
+		auditID, stage, at(received), at(reached))
+}
+
+func TestDoWorkDeduplication(t *testing.T) {
+	dir := filepath.Dir(writeTempFile(t, "a.log", []byte(
+		stageEvent("r1", stageRequestReceived, 0, 0)+
+			stageEvent("r2", stageRequestReceived, 1, 1)+
+			stageEvent("r1", stageResponseComplete, 0, 2)+
+			stageEvent("r2", stageResponseStarted, 1, 3))))
+	defer os.RemoveAll(dir)
+	// The log of another replica has a copy of r1.
+	replica := stageEvent("r1", stageResponseComplete, 0, 2) +
+		stageEvent("r2", stageResponseComplete, 1, 5) +
+		stageEvent("r3", stageRequestReceived, 6, 6) +
+		stageEvent("", stageResponseComplete, 7, 7)
+	if err := ioutil.WriteFile(filepath.Join(dir, "b.log"), []byte(replica), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode := range []pb.Deduplication{pb.Deduplication_DEDUPLICATION_LATEST_STAGE, pb.Deduplication_DEDUPLICATION_COMBINED} {
+		stream := &fakeWorkStream{ctx: context.Background()}
+		err := newTestServer(nil).DoWork(&pb.Work{
+			Files:         []string{"file://" + dir + "/a.log", "file://" + dir + "/b.log"},
+			Deduplication: mode,
+			Projection:    []string{"auditID,stage"},
+		}, stream)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var lines []string
+		stages := map[string]*pb.Stages{}
+		for _, line := range stream.lines() {
+			lines = append(lines, line.Projection)
+			stages[strings.SplitN(line.Projection, `"`, 5)[3]] = line.Stages
+		}
+		// Finished requests come as their final stage is read, the line
+		// without an ID right away and the unfinished request at the end.
+		expected := []string{
+			`{"auditID":"r1","stage":"ResponseComplete"}`,
+			`{"auditID":"r2","stage":"ResponseComplete"}`,
+			`{"auditID":"","stage":"ResponseComplete"}`,
+			`{"auditID":"r3","stage":"RequestReceived"}`,
+		}
+		if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("%v: expected lines %v, got %v", mode, expected, lines)
+		}
+		for _, result := range stream.results {
+			if result.Cursor != nil {
+				t.Errorf("%v: expected no cursors, got %v", mode, result.Cursor)
+			}
+		}
+		summary := stream.results[len(stream.results)-1].Summary
+		if summary.DuplicateLines != 4 || summary.LinesMatched != 8 {
+			t.Errorf("%v: unexpected summary %v", mode, summary)
+		}
+
+		if mode == pb.Deduplication_DEDUPLICATION_LATEST_STAGE {
+			for id, stage := range stages {
+				if stage != nil {
+					t.Errorf("%v: expected no stages for %s, got %v", mode, id, stage)
+				}
+			}
+			continue
+		}
+		for _, test := range []struct {
+			auditID                     string
+			timeToFirstByte, duration   time.Duration
+			received, started, complete bool
+		}{
+			{"r1", 0, 2 * time.Second, true, false, true},
+			{"r2", 2 * time.Second, 4 * time.Second, true, true, true},
+			{"r3", 0, 0, true, false, false},
+		} {
+			stage := stages[test.auditID]
+			if stage == nil {
+				t.Errorf("Expected stages for %s", test.auditID)
+				continue
+			}
+			ttfb, _ := ptypes.Duration(stage.TimeToFirstByte)
+			duration, _ := ptypes.Duration(stage.Duration)
+			if ttfb != test.timeToFirstByte || duration != test.duration ||
+				(stage.RequestReceived != nil) != test.received ||
+				(stage.ResponseStarted != nil) != test.started ||
+				(stage.ResponseComplete != nil) != test.complete || stage.Panic != nil {
+				t.Errorf("Unexpected stages for %s: %v", test.auditID, stage)
+			}
+		}
+	}
+}
+
+func TestDoWorkDeduplicationWindow(t *testing.T) {
+	path := writeTempFile(t, "a.log", []byte(
+		stageEvent("r1", stageRequestReceived, 0, 0)+
+			stageEvent("r2", stageRequestReceived, 5, 5)+
+			stageEvent("r2", stageResponseComplete, 5, 6)+
+			stageEvent("r3", stageRequestReceived, 20, 20)+
+			stageEvent("r1", stageResponseComplete, 0, 25)+
+			stageEvent("r2", stageResponseComplete, 5, 6)+
+			stageEvent("r4", stageRequestReceived, 30, 30)))
+	defer os.RemoveAll(filepath.Dir(path))
+
+	stream := &fakeWorkStream{ctx: context.Background()}
+	err := newTestServer(nil).DoWork(&pb.Work{
+		File:                "file://" + path,
+		Deduplication:       pb.Deduplication_DEDUPLICATION_LATEST_STAGE,
+		DeduplicationWindow: &duration.Duration{Seconds: 10},
+		TimestampField:      pb.TimestampField_TIMESTAMP_STAGE,
+		Projection:          []string{"auditID,stage"},
+	}, stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, line := range stream.lines() {
+		lines = append(lines, line.Projection)
+	}
+	// r1 is returned unfinished once r3 is read, and its last line left
+	// out. The copy of r2 comes after r2 was forgotten.
+	expected := []string{
+		`{"auditID":"r2","stage":"ResponseComplete"}`,
+		`{"auditID":"r1","stage":"RequestReceived"}`,
+		`{"auditID":"r2","stage":"ResponseComplete"}`,
+		`{"auditID":"r3","stage":"RequestReceived"}`,
+		`{"auditID":"r4","stage":"RequestReceived"}`,
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected lines %v, got %v", expected, lines)
+	}
+	if summary := stream.results[len(stream.results)-1].Summary; summary.DuplicateLines != 2 {
+		t.Errorf("Unexpected summary %v", summary)
+	}
+}
+
+func TestDoWorkDeduplicationErrors(t *testing.T) {
+	path := writeTempFile(t, "a.log", []byte(stageEvent("r1", stageResponseComplete, 0, 1)))
+	defer os.RemoveAll(filepath.Dir(path))
+	for _, request := range []*pb.Work{
+		{File: "file://" + path, Deduplication: pb.Deduplication_DEDUPLICATION_COMBINED, Cursor: &pb.Cursor{Source: "file://" + path}},
+		{File: "file://" + path, Deduplication: pb.Deduplication(7)},
+		{File: "file://" + path, Deduplication: pb.Deduplication_DEDUPLICATION_LATEST_STAGE, DeduplicationWindow: &duration.Duration{Seconds: -1}},
+	} {
+		err := newTestServer(nil).DoWork(request, &fakeWorkStream{ctx: context.Background()})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument for %v, got %v", request, err)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	pb "github.com/kzmrv/gcsreader/proto"
+)
+
+// eventPredicate reports whether a parsed audit event should be kept.
+type eventPredicate func(e *auditEvent) bool
+
+// linePredicate is an eventPredicate that also depends on where the line
+// was read.
+type linePredicate func(e *logEntry) bool
+
+// newFieldFilter builds a predicate requiring every non-empty field of
+// filters to match the event. It returns nil when there is nothing to check.
+func newFieldFilter(filters *pb.FieldFilters) (eventPredicate, error) {
+	if filters == nil {
+		return nil, nil
+	}
+
+	var predicates []eventPredicate
+	for _, field := range []struct {
+		name    string
+		matches []*pb.StringMatch
+	}{
+		{"verb", filters.Verb},
+		{"user.username", filters.Username},
+		{"user.groups", filters.UserGroup},
+		{"objectRef.resource", filters.Resource},
+		{"objectRef.subresource", filters.Subresource},
+		{"objectRef.namespace", filters.Namespace},
+		{"objectRef.name", filters.Name},
+		{"objectRef.apiGroup", filters.ApiGroup},
+		{"stage", filters.Stage},
+		{"level", filters.Level},
+		{"userAgent", filters.UserAgent},
+		{"sourceIPs", filters.SourceIP},
+	} {
+		if len(field.matches) == 0 {
+			continue
+		}
+		predicate, err := newFieldMatcher(field.name, field.matches)
+		if err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, predicate)
+	}
+	if len(filters.ResponseCode) != 0 {
+		predicates = append(predicates, newCodeRangeMatcher(filters.ResponseCode))
+	}
+	if len(filters.Latency) != 0 {
+		latency, err := newLatencyRangeMatcher(filters.Latency)
+		if err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, latency)
+	}
+
+	return allOf(predicates...), nil
+}
+
+// allOf matches events passing every non-nil predicate. It returns nil
+// when there is nothing to check.
+func allOf(predicates ...eventPredicate) eventPredicate {
+	var checked []eventPredicate
+	for _, predicate := range predicates {
+		if predicate != nil {
+			checked = append(checked, predicate)
+		}
+	}
+	switch len(checked) {
+	case 0:
+		return nil
+	case 1:
+		return checked[0]
+	}
+	return func(e *auditEvent) bool {
+		for _, predicate := range checked {
+			if !predicate(e) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// anyOf matches events passing at least one of predicates.
+func anyOf(predicates ...eventPredicate) eventPredicate {
+	return func(e *auditEvent) bool {
+		for _, predicate := range predicates {
+			if predicate(e) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// anyValue matches events where any value of the field passes matches.
+func anyValue(values func(e *auditEvent) []string, matches func(string) bool) eventPredicate {
+	return func(e *auditEvent) bool {
+		for _, value := range values(e) {
+			if matches(value) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// newFieldMatcher matches events where any value of the field passes any
+// of matches.
+func newFieldMatcher(field string, matches []*pb.StringMatch) (eventPredicate, error) {
+	values := auditFields[field]
+	matchers := make([]func(string) bool, len(matches))
+	for i, match := range matches {
+		matcher, err := newStringMatcher(match)
+		if err != nil {
+			return nil, fmt.Errorf("bad %s filter: %v", field, err)
+		}
+		matchers[i] = matcher
+	}
+	return anyValue(values, func(value string) bool {
+		for _, matcher := range matchers {
+			if matcher(value) {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+func newStringMatcher(match *pb.StringMatch) (func(string) bool, error) {
+	switch match.Type {
+	case pb.MatchType_MATCH_EXACT:
+		return func(value string) bool { return value == match.Value }, nil
+	case pb.MatchType_MATCH_PREFIX:
+		return func(value string) bool { return strings.HasPrefix(value, match.Value) }, nil
+	case pb.MatchType_MATCH_REGEX:
+		regex, err := regexp.Compile(match.Value)
+		if err != nil {
+			return nil, err
+		}
+		return regex.MatchString, nil
+	}
+	return nil, fmt.Errorf("unknown match type %v", match.Type)
+}
+
+func newCodeRangeMatcher(ranges []*pb.CodeRange) eventPredicate {
+	return func(e *auditEvent) bool {
+		if e.ResponseStatus == nil {
+			return false
+		}
+		code := e.ResponseStatus.Code
+		for _, codeRange := range ranges {
+			if (codeRange.Min == 0 || code >= codeRange.Min) && (codeRange.Max == 0 || code <= codeRange.Max) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// newLatencyRangeMatcher matches events whose latency falls into any of
+// ranges. Events without a stage timestamp never match.
+func newLatencyRangeMatcher(ranges []*pb.LatencyRange) (eventPredicate, error) {
+	type bounds struct{ min, max time.Duration }
+	parsed := make([]bounds, len(ranges))
+	for i, latencyRange := range ranges {
+		var err error
+		if latencyRange.Min != nil {
+			if parsed[i].min, err = ptypes.Duration(latencyRange.Min); err != nil {
+				return nil, fmt.Errorf("bad latency filter: %v", err)
+			}
+		}
+		if latencyRange.Max != nil {
+			if parsed[i].max, err = ptypes.Duration(latencyRange.Max); err != nil {
+				return nil, fmt.Errorf("bad latency filter: %v", err)
+			}
+		}
+	}
+	return func(e *auditEvent) bool {
+		latency, ok := e.latency()
+		if !ok {
+			return false
+		}
+		for _, b := range parsed {
+			if (b.min == 0 || latency >= b.min) && (b.max == 0 || latency <= b.max) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
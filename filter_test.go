@@ -0,0 +1,86 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/duration"
+	pb "github.com/kzmrv/gcsreader/proto"
+)
+
+func TestFieldFilters(t *testing.T) {
+	events := parseEvents(t, line1, line2, line3)
+	for _, test := range []struct {
+		name     string
+		filters  *pb.FieldFilters
+		expected []bool
+	}{
+		{"none", &pb.FieldFilters{}, []bool{true, true, true}},
+		{"verb exact", &pb.FieldFilters{Verb: []*pb.StringMatch{exact("update")}}, []bool{true, true, false}},
+		{"verb any of", &pb.FieldFilters{Verb: []*pb.StringMatch{exact("get"), exact("patch")}}, []bool{false, false, true}},
+		{"username prefix", &pb.FieldFilters{Username: []*pb.StringMatch{{Type: pb.MatchType_MATCH_PREFIX, Value: "system:node:"}}}, []bool{true, true, false}},
+		{"group", &pb.FieldFilters{UserGroup: []*pb.StringMatch{exact("system:nodes")}}, []bool{true, true, false}},
+		{"name regex", &pb.FieldFilters{Name: []*pb.StringMatch{{Type: pb.MatchType_MATCH_REGEX, Value: "group-2-"}}}, []bool{false, true, true}},
+		{"subresource", &pb.FieldFilters{Subresource: []*pb.StringMatch{exact("status")}}, []bool{false, false, true}},
+		{"source ip", &pb.FieldFilters{SourceIP: []*pb.StringMatch{{Type: pb.MatchType_MATCH_PREFIX, Value: "35.22"}}}, []bool{true, true, false}},
+		{"level and namespace", &pb.FieldFilters{
+			Level:     []*pb.StringMatch{exact("Metadata")},
+			Namespace: []*pb.StringMatch{exact("kube-node-lease")},
+		}, []bool{true, true, false}},
+		{"code range", &pb.FieldFilters{ResponseCode: []*pb.CodeRange{{Min: 200, Max: 299}}}, []bool{true, true, true}},
+		{"error codes", &pb.FieldFilters{ResponseCode: []*pb.CodeRange{{Min: 400}}}, []bool{false, false, false}},
+		{"slow", &pb.FieldFilters{Latency: []*pb.LatencyRange{{Min: &duration.Duration{Nanos: 2000000}}}}, []bool{true, false, true}},
+		{"slow at stage", &pb.FieldFilters{
+			Stage:   []*pb.StringMatch{exact("ResponseComplete")},
+			Latency: []*pb.LatencyRange{{Min: &duration.Duration{Nanos: 2000000}, Max: &duration.Duration{Nanos: 3000000}}},
+		}, []bool{true, false, false}},
+	} {
+		predicate, err := newFieldFilter(test.filters)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		for i, event := range events {
+			if matched := predicate == nil || predicate(event); matched != test.expected[i] {
+				t.Errorf("%s: expected line%v match to be %v", test.name, i+1, test.expected[i])
+			}
+		}
+	}
+}
+
+func TestFieldFilterBadRegex(t *testing.T) {
+	_, err := newFieldFilter(&pb.FieldFilters{Verb: []*pb.StringMatch{{Type: pb.MatchType_MATCH_REGEX, Value: "("}}})
+	if err == nil {
+		t.Fatal("Expected error for bad regex")
+	}
+}
+
+func exact(value string) *pb.StringMatch {
+	return &pb.StringMatch{Type: pb.MatchType_MATCH_EXACT, Value: value}
+}
+
+func parseEvents(t *testing.T, lines ...string) []*auditEvent {
+	events := make([]*auditEvent, len(lines))
+	for i, line := range lines {
+		entry, err := parseLine(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		events[i] = entry.event
+	}
+	return events
+}
@@ -0,0 +1,528 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/flate"
+	"github.com/kzmrv/gcsreader/internal/common"
+	pb "github.com/kzmrv/gcsreader/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	log "k8s.io/klog"
+)
+
+// checkpointSpan is the least uncompressed distance between checkpoints.
+// Each checkpoint keeps a 32KiB window, like zlib's zran example, which is
+// stored compressed.
+var checkpointSpan int64 = 1 << 20
+
+// indexBuilds is how many objects are indexed at once.
+const indexBuilds = 2
+
+// gzipIndex lists points a gzip object can be decompressed from without
+// reading what comes before them.
+type gzipIndex struct {
+	Checkpoints []gzipCheckpoint
+	// Members are the byte offsets of the gzip members after the first.
+	Members []int64
+
+	// path is the file the windows are read from.
+	path string
+}
+
+// gzipCheckpoint is the start of a deflate block. Blocks rarely start on
+// line boundaries, so it also records the first line starting after it.
+type gzipCheckpoint struct {
+	// In is the compressed position in bits, Out the uncompressed one.
+	In  int64
+	Out int64
+	// WindowOffset and WindowLength locate the compressed window in the
+	// index file.
+	WindowOffset int64
+	WindowLength int64
+
+	LineOffset int64
+	LineNumber int64
+	// Latest is the latest timestamp of the lines before LineOffset.
+	Latest time.Time
+}
+
+// seek returns the last checkpoint at or before where reading can start
+// and the line reading starts at, or nil when that is the beginning.
+// Lines are skipped up to start, and up to the last checkpoint whose
+// earlier lines are all at or before since.
+func (index *gzipIndex) seek(since time.Time, start linePosition) (*gzipCheckpoint, linePosition) {
+	checkpoints := index.Checkpoints
+	target := start
+	if !since.IsZero() {
+		i := sort.Search(len(checkpoints), func(i int) bool { return checkpoints[i].Latest.After(since) })
+		if i > 0 && checkpoints[i-1].LineOffset > target.offset {
+			target = linePosition{offset: checkpoints[i-1].LineOffset, lineNumber: checkpoints[i-1].LineNumber}
+		}
+	}
+	i := sort.Search(len(checkpoints), func(i int) bool { return checkpoints[i].LineOffset > target.offset })
+	if i == 0 {
+		return nil, linePosition{}
+	}
+	return &checkpoints[i-1], target
+}
+
+// nextMember returns the byte offset of the gzip member after the bit
+// position in, or -1 when in is in the last member.
+func (index *gzipIndex) nextMember(in int64) int64 {
+	i := sort.Search(len(index.Members), func(i int) bool { return index.Members[i] > in/8 })
+	if i == len(index.Members) {
+		return -1
+	}
+	return index.Members[i]
+}
+
+// window reads the window preceding checkpoint.
+func (index *gzipIndex) window(checkpoint *gzipCheckpoint) ([]byte, error) {
+	file, err := os.Open(index.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ioutil.ReadAll(flate.NewReader(io.NewSectionReader(file, checkpoint.WindowOffset, checkpoint.WindowLength)))
+}
+
+// indexBuilder decompresses a gzip object and records checkpoints about
+// every checkpointSpan bytes, writing their windows to file.
+type indexBuilder struct {
+	decoder *gzipDecoder
+	file    *indexFile
+	index   gzipIndex
+	last    int64
+	// pending checkpoints wait for the next line start.
+	pending []gzipCheckpoint
+	err     error
+
+	line     []byte
+	position linePosition
+	latest   time.Time
+}
+
+func newIndexBuilder(reader io.Reader, file *indexFile) *indexBuilder {
+	b := &indexBuilder{decoder: newGzipDecoder(reader), file: file}
+	b.decoder.onBlock = b.checkpoint
+	b.decoder.onMember = func(offset int64) {
+		if offset != 0 {
+			b.index.Members = append(b.index.Members, offset)
+		}
+	}
+	return b
+}
+
+func (b *indexBuilder) checkpoint(in, out int64) {
+	if out-b.last < checkpointSpan || b.err != nil {
+		return
+	}
+	b.last = out
+	checkpoint := gzipCheckpoint{In: in, Out: out}
+	checkpoint.WindowOffset, checkpoint.WindowLength, b.err = b.file.addWindow(b.decoder.windowContent())
+	b.pending = append(b.pending, checkpoint)
+	b.resolve()
+}
+
+func (b *indexBuilder) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	n, err := b.decoder.Read(p)
+	for data := p[:n]; len(data) > 0; {
+		i := bytes.IndexByte(data, '\n')
+		if i == -1 {
+			b.line = append(b.line, data...)
+			break
+		}
+		b.line = append(b.line, data[:i]...)
+		data = data[i+1:]
+		b.endLine()
+	}
+	return n, err
+}
+
+func (b *indexBuilder) endLine() {
+	if len(bytes.TrimSpace(b.line)) != 0 {
+		timestamp, ok := lineTimestamp(b.line)
+		if !ok {
+			// Nothing after a line of unknown time may be skipped.
+			timestamp = time.Unix(1<<62, 0)
+		}
+		if timestamp.After(b.latest) {
+			b.latest = timestamp
+		}
+	}
+	b.position.offset += int64(len(b.line)) + 1
+	b.position.lineNumber++
+	b.line = b.line[:0]
+	b.resolve()
+}
+
+func (b *indexBuilder) resolve() {
+	for len(b.pending) > 0 && b.pending[0].Out <= b.position.offset {
+		checkpoint := b.pending[0]
+		checkpoint.LineOffset = b.position.offset
+		checkpoint.LineNumber = b.position.lineNumber
+		checkpoint.Latest = b.latest
+		b.index.Checkpoints = append(b.index.Checkpoints, checkpoint)
+		b.pending = b.pending[1:]
+	}
+}
+
+// indexedTimestamps are the fields lineTimestamp reads. Request and
+// response bodies may have fields of the same names, so only the top
+// level of the line is looked at.
+type indexedTimestamps struct {
+	StageTimestamp           string `json:"stageTimestamp"`
+	RequestReceivedTimestamp string `json:"requestReceivedTimestamp"`
+	Timestamp                string `json:"timestamp"`
+}
+
+// lineTimestamp finds the stage timestamp of an audit line, which is not
+// before any other timestamp of the event, decoding only the timestamp
+// fields. Events without a stage fall back to the time they were received.
+func lineTimestamp(line []byte) (time.Time, bool) {
+	var fields indexedTimestamps
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return time.Time{}, false
+	}
+	for _, value := range []string{fields.StageTimestamp, fields.RequestReceivedTimestamp, fields.Timestamp} {
+		if timestamp, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			return timestamp, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// indexStore persists checkpoint indexes in a local directory and builds
+// missing ones in the background.
+type indexStore struct {
+	dir string
+	// builds limits the objects indexed at once.
+	builds chan struct{}
+
+	mu sync.Mutex
+	// building holds the keys of the objects being indexed.
+	building map[string]bool
+	wg       sync.WaitGroup
+}
+
+func newIndexStore(dir string) *indexStore {
+	return &indexStore{dir: dir, builds: make(chan struct{}, indexBuilds), building: map[string]bool{}}
+}
+
+func (s *indexStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+".gzindex")
+}
+
+// load reads the checkpoints of an index, leaving the windows on disk. It
+// returns nil when there is no index for key yet.
+func (s *indexStore) load(key string) (*gzipIndex, error) {
+	path := s.path(key)
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	var trailer [8]byte
+	if _, err := file.ReadAt(trailer[:], info.Size()-8); err != nil {
+		return nil, fmt.Errorf("truncated index: %v", err)
+	}
+	offset := int64(binary.BigEndian.Uint64(trailer[:]))
+	if offset < 0 || offset > info.Size()-8 {
+		return nil, fmt.Errorf("corrupt index")
+	}
+	index := &gzipIndex{path: path}
+	if err := gob.NewDecoder(io.NewSectionReader(file, offset, info.Size()-8-offset)).Decode(index); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// build runs fn in the background unless key is being indexed already or
+// too many objects are. A later read of the object tries again then.
+func (s *indexStore) build(key string, fn func() error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.building[key] {
+		return
+	}
+	select {
+	case s.builds <- struct{}{}:
+	default:
+		return
+	}
+	s.building[key] = true
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		err := fn()
+		if err != nil {
+			log.Errorf("Failed to index %v: %v", key, err)
+		}
+		s.mu.Lock()
+		delete(s.building, key)
+		s.mu.Unlock()
+		<-s.builds
+	}()
+}
+
+// wait returns once the indexes being built are done.
+func (s *indexStore) wait() {
+	s.wg.Wait()
+}
+
+// indexFile writes an index to a temporary file: the compressed windows of
+// the checkpoints as they are found, then the gob encoded index and its
+// offset as the last 8 bytes. Committing renames it, so concurrent readers
+// never see a partial index.
+type indexFile struct {
+	file       *os.File
+	writer     *bufio.Writer
+	size       int64
+	window     bytes.Buffer
+	compressor *flate.Writer
+}
+
+func (s *indexStore) create() (*indexFile, error) {
+	file, err := ioutil.TempFile(s.dir, "gzindex")
+	if err != nil {
+		return nil, err
+	}
+	compressor, _ := flate.NewWriter(nil, flate.BestSpeed)
+	return &indexFile{file: file, writer: bufio.NewWriter(file), compressor: compressor}, nil
+}
+
+// addWindow returns where the compressed window was written.
+func (f *indexFile) addWindow(window []byte) (int64, int64, error) {
+	f.window.Reset()
+	f.compressor.Reset(&f.window)
+	if _, err := f.compressor.Write(window); err != nil {
+		return 0, 0, err
+	}
+	if err := f.compressor.Close(); err != nil {
+		return 0, 0, err
+	}
+	offset := f.size
+	n, err := f.writer.Write(f.window.Bytes())
+	f.size += int64(n)
+	return offset, int64(n), err
+}
+
+func (f *indexFile) commit(path string, index *gzipIndex) error {
+	offset := f.size
+	err := gob.NewEncoder(f.writer).Encode(index)
+	if err == nil {
+		var trailer [8]byte
+		binary.BigEndian.PutUint64(trailer[:], uint64(offset))
+		_, err = f.writer.Write(trailer[:])
+	}
+	if err == nil {
+		err = f.writer.Flush()
+	}
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.file.Name(), path)
+}
+
+// discard removes the file unless it was committed.
+func (f *indexFile) discard() {
+	f.file.Close()
+	os.Remove(f.file.Name())
+}
+
+// openObject returns the decompressed content of a single object and the
+// line position it starts at. With an index directory configured, gzip
+// objects are read from the checkpoint closest to where filters start
+// reading at or after start. Objects without an index are read as usual
+// while one is built in the background.
+func (s *serverType) openObject(ctx context.Context, location *url.URL, compression pb.Compression, filters *lineFilter, start linePosition) (io.ReadCloser, linePosition, error) {
+	if s.indexes == nil || (compression != pb.Compression_COMPRESSION_AUTO && compression != pb.Compression_COMPRESSION_GZIP) {
+		reader, err := s.downloadAndDecompress(ctx, location, compression)
+		return reader, linePosition{}, err
+	}
+	key, err := s.indexKey(ctx, location)
+	if err != nil {
+		log.Warningf("Not indexing %v: %v", location, err)
+		reader, err := s.downloadAndDecompress(ctx, location, compression)
+		return reader, linePosition{}, err
+	}
+	index, err := s.indexes.load(key)
+	if err != nil {
+		log.Warningf("Failed to load the index of %v: %v", location, err)
+	}
+	if index == nil {
+		s.indexes.build(key, func() error { return s.buildIndex(location, key) })
+	} else if checkpoint, position := index.seek(filters.seekSince, start); checkpoint != nil {
+		reader, err := s.openCheckpoint(ctx, location, index, checkpoint, position)
+		if err == nil {
+			log.Infof("Reading %v from line %v", location, position.lineNumber)
+			return reader, position, nil
+		}
+		if status.Code(err) != codes.DataLoss {
+			return nil, linePosition{}, err
+		}
+		log.Warningf("Failed to read %v from its index: %v", location, err)
+	}
+	reader, err := s.downloadAndDecompress(ctx, location, compression)
+	return reader, linePosition{}, err
+}
+
+// buildIndex reads a whole object to index it. Objects that are not gzip
+// get an index without checkpoints, so they are not read again for it.
+func (s *serverType) buildIndex(location *url.URL, key string) error {
+	defer common.TimeTrack(time.Now(), "Indexing "+location.String())
+	reader, err := s.download(context.Background(), location, 0)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	file, err := s.indexes.create()
+	if err != nil {
+		return err
+	}
+	defer file.discard()
+
+	buffered := bufio.NewReader(reader)
+	index := &gzipIndex{}
+	if detectCompression(buffered) == pb.Compression_COMPRESSION_GZIP {
+		builder := newIndexBuilder(buffered, file)
+		if _, err := io.Copy(ioutil.Discard, builder); err != nil {
+			return err
+		}
+		index = &builder.index
+	}
+	if err := file.commit(s.indexes.path(key), index); err != nil {
+		return err
+	}
+	log.Infof("Indexed %v with %v checkpoints", location, len(index.Checkpoints))
+	return nil
+}
+
+// indexKey changes whenever the object is replaced, so a stale index is
+// never used.
+func (s *serverType) indexKey(ctx context.Context, location *url.URL) (string, error) {
+	source, err := resolveSource(s.sources, location)
+	if err != nil {
+		return "", err
+	}
+	info, err := source.stat(ctx, location)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s#%d:%d", objectKey(location), info.generation, info.size), nil
+}
+
+// openCheckpoint range reads an object from checkpoint and skips to the
+// line at position. Corrupt indexes fail with DataLoss.
+func (s *serverType) openCheckpoint(ctx context.Context, location *url.URL, index *gzipIndex, checkpoint *gzipCheckpoint, position linePosition) (io.ReadCloser, error) {
+	window, err := index.window(checkpoint)
+	if err != nil {
+		return nil, dataLossError(err)
+	}
+	reader, err := s.download(ctx, location, checkpoint.In/8)
+	if err != nil {
+		return nil, err
+	}
+	member, err := resumeGzipDecoder(reader, checkpoint.In, window)
+	if err != nil {
+		reader.Close()
+		return nil, dataLossError(err)
+	}
+	members := &checkpointReader{member: member, source: reader}
+	if next := index.nextMember(checkpoint.In); next != -1 {
+		members.next = func() (io.ReadCloser, error) {
+			reader, err := s.download(ctx, location, next)
+			if err != nil {
+				return nil, err
+			}
+			decompressed, err := decompress(reader, pb.Compression_COMPRESSION_GZIP)
+			if err != nil {
+				reader.Close()
+				return nil, err
+			}
+			return &decompressedReader{ReadCloser: decompressed, source: reader}, nil
+		}
+	}
+	decompressed := &checkedReader{members}
+	if _, err := io.CopyN(ioutil.Discard, decompressed, position.offset-checkpoint.Out); err != nil {
+		decompressed.Close()
+		return nil, dataLossError(err)
+	}
+	return decompressed, nil
+}
+
+// checkpointReader reads the rest of the gzip member a checkpoint is in,
+// then the members following it with a regular gzip reader.
+type checkpointReader struct {
+	member io.Reader
+	source io.Closer
+	// next opens the following members, it is nil when there are none.
+	next func() (io.ReadCloser, error)
+	rest io.ReadCloser
+}
+
+func (r *checkpointReader) Read(p []byte) (int, error) {
+	if r.rest != nil {
+		return r.rest.Read(p)
+	}
+	n, err := r.member.Read(p)
+	if err == io.EOF && r.next != nil {
+		r.rest, err = r.next()
+		r.next = nil
+	}
+	return n, err
+}
+
+func (r *checkpointReader) Close() error {
+	if r.rest != nil {
+		r.rest.Close()
+	}
+	return r.source.Close()
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	pb "github.com/kzmrv/gcsreader/proto"
+)
+
+var auditLogStart = time.Date(2019, 1, 2, 15, 0, 0, 0, time.UTC)
+
+// auditLog returns lines received 10ms apart. Every seventh takes two
+// seconds, so lines are written out of received order.
+func auditLog(lines int) string {
+	var log strings.Builder
+	for i := 0; i < lines; i++ {
+		received := auditLogStart.Add(time.Duration(i) * 10 * time.Millisecond)
+		stage := received.Add(time.Millisecond)
+		if i%7 == 0 {
+			stage = received.Add(2 * time.Second)
+		}
+		fmt.Fprintf(&log, `{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"Metadata","auditID":"%08x-%d","stage":"ResponseComplete","requestURI":"/api/v1/namespaces/default/pods/pod-%d","verb":"get","requestReceivedTimestamp":"%s","stageTimestamp":"%s"}`+"\n",
+			i*2654435761, i, i%97, received.Format(time.RFC3339Nano), stage.Format(time.RFC3339Nano))
+	}
+	return log.String()
+}
+
+func TestLineTimestamp(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		line     string
+		expected time.Time
+	}{
+		{"stage", line3, time.Date(2019, 1, 2, 15, 1, 16, 108460000, time.UTC)},
+		{"received", `{"kind":"Event","requestReceivedTimestamp":"2019-01-02T15:01:16.105964Z"}`, time.Date(2019, 1, 2, 15, 1, 16, 105964000, time.UTC)},
+		{"body first", `{"kind":"Event","requestObject":{"stageTimestamp":"2019-01-02T14:00:00Z"},"stageTimestamp":"2019-01-02T15:01:16Z"}`, time.Date(2019, 1, 2, 15, 1, 16, 0, time.UTC)},
+		{"body last", `{"kind":"Event","stageTimestamp":"2019-01-02T15:01:16Z","responseObject":{"stageTimestamp":"2019-01-02T14:00:00Z"}}`, time.Date(2019, 1, 2, 15, 1, 16, 0, time.UTC)},
+		{"none", `{"kind":"Event"}`, time.Time{}},
+		{"malformed", `{"kind":"Event","stageTimestamp":"2019-01-02T15:01:16Z"`, time.Time{}},
+	} {
+		timestamp, ok := lineTimestamp([]byte(test.line))
+		if ok != !test.expected.IsZero() || !timestamp.Equal(test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, timestamp)
+		}
+	}
+}
+
+func TestIndexSeek(t *testing.T) {
+	at := func(seconds int) time.Time { return auditLogStart.Add(time.Duration(seconds) * time.Second) }
+	index := &gzipIndex{Checkpoints: []gzipCheckpoint{
+		{Out: 90, LineOffset: 100, LineNumber: 1, Latest: at(1)},
+		{Out: 190, LineOffset: 200, LineNumber: 2, Latest: at(2)},
+		{Out: 290, LineOffset: 300, LineNumber: 3, Latest: at(3)},
+	}}
+	for _, test := range []struct {
+		name       string
+		since      time.Time
+		start      linePosition
+		checkpoint int64
+		position   linePosition
+	}{
+		{"beginning", time.Time{}, linePosition{}, 0, linePosition{}},
+		{"before the first checkpoint", time.Time{}, linePosition{offset: 50, lineNumber: 1}, 0, linePosition{}},
+		{"cursor", time.Time{}, linePosition{offset: 250, lineNumber: 3}, 190, linePosition{offset: 250, lineNumber: 3}},
+		{"since", at(2), linePosition{}, 190, linePosition{offset: 200, lineNumber: 2}},
+		{"since between checkpoints", at(2).Add(time.Millisecond), linePosition{}, 190, linePosition{offset: 200, lineNumber: 2}},
+		{"since before all lines", at(0), linePosition{}, 0, linePosition{}},
+		{"since after all lines", at(4), linePosition{}, 290, linePosition{offset: 300, lineNumber: 3}},
+		{"cursor after since", at(1), linePosition{offset: 310, lineNumber: 4}, 290, linePosition{offset: 310, lineNumber: 4}},
+	} {
+		checkpoint, position := index.seek(test.since, test.start)
+		out := int64(0)
+		if checkpoint != nil {
+			out = checkpoint.Out
+		}
+		if out != test.checkpoint || position != test.position {
+			t.Errorf("%s: expected checkpoint %v and %+v, got %v and %+v", test.name, test.checkpoint, test.position, out, position)
+		}
+	}
+}
+
+func TestDoWorkWithIndex(t *testing.T) {
+	defer func(span int64) { checkpointSpan = span }(checkpointSpan)
+	checkpointSpan = 64 << 10
+
+	// Checkpoints in either member are read from, the first one up to
+	// its end.
+	content := auditLog(5000)
+	path := writeTempFile(t, "audit.log.gz", append(gzipped(t, content[:len(content)/2]), gzipped(t, content[len(content)/2:])...))
+	defer os.RemoveAll(filepath.Dir(path))
+	indexDir := filepath.Join(filepath.Dir(path), "indexes")
+	if err := os.Mkdir(indexDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	indexed := newTestServer(nil)
+	indexed.indexes = newIndexStore(indexDir)
+
+	// The first read builds the index in the background.
+	if err := indexed.DoWork(&pb.Work{File: "file://" + path, MaxLines: 1}, &fakeWorkStream{ctx: context.Background()}); err != nil {
+		t.Fatal(err)
+	}
+	indexed.indexes.wait()
+	key, err := indexed.indexKey(context.Background(), mustParseObjectPath(t, "file://"+path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := indexed.indexes.load(key)
+	if err != nil || index == nil {
+		t.Fatalf("Expected an index, got %v, %v", index, err)
+	}
+	if len(index.Checkpoints) < 10 || len(index.Members) != 1 {
+		t.Fatalf("Expected at least 10 checkpoints in 2 members, got %v in %v", len(index.Checkpoints), len(index.Members)+1)
+	}
+
+	since, _ := ptypes.TimestampProto(auditLogStart.Add(35 * time.Second))
+	cursor := &pb.Cursor{Source: "file://" + path, Offset: int64(len(strings.Join(strings.SplitAfter(content, "\n")[:3000], ""))), LineNumber: 3000}
+	for _, test := range []struct {
+		name string
+		work func() *pb.Work
+		// Skipping to a cursor scans as many lines with or without index.
+		seeksSince bool
+	}{
+		{"since", func() *pb.Work { return &pb.Work{File: "file://" + path, Since: since} }, true},
+		{"stage since", func() *pb.Work {
+			return &pb.Work{File: "file://" + path, Since: since, TimestampField: pb.TimestampField_TIMESTAMP_STAGE}
+		}, true},
+		{"cursor", func() *pb.Work { return &pb.Work{File: "file://" + path, Cursor: cursor} }, false},
+		{"cursor and since", func() *pb.Work { return &pb.Work{File: "file://" + path, Since: since, Cursor: cursor} }, false},
+	} {
+		expected := &fakeWorkStream{ctx: context.Background()}
+		if err := newTestServer(nil).DoWork(test.work(), expected); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		seeked := &fakeWorkStream{ctx: context.Background()}
+		if err := indexed.DoWork(test.work(), seeked); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		expectedLines, lines := expected.lines(), seeked.lines()
+		if len(lines) == 0 || len(lines) != len(expectedLines) {
+			t.Fatalf("%s: expected %v lines, got %v", test.name, len(expectedLines), len(lines))
+		}
+		for i := range lines {
+			if lines[i].Entry != expectedLines[i].Entry {
+				t.Fatalf("%s: line %v differs", test.name, i)
+			}
+		}
+		expectedSummary := expected.results[len(expected.results)-1]
+		summary := seeked.results[len(seeked.results)-1]
+		if test.seeksSince && summary.Summary.LinesScanned >= expectedSummary.Summary.LinesScanned {
+			t.Errorf("%s: expected fewer than %v lines scanned, got %v", test.name, expectedSummary.Summary.LinesScanned, summary.Summary.LinesScanned)
+		}
+		if summary.Cursor.String() != expectedSummary.Cursor.String() {
+			t.Errorf("%s: expected cursor %v, got %v", test.name, expectedSummary.Cursor, summary.Cursor)
+		}
+	}
+
+	// Lines between checkpoints are never skipped, wherever the window
+	// starts.
+	for seconds := 0; seconds < 52; seconds += 3 {
+		since, _ := ptypes.TimestampProto(auditLogStart.Add(time.Duration(seconds) * time.Second))
+		for _, field := range []pb.TimestampField{pb.TimestampField_TIMESTAMP_RECEIVED, pb.TimestampField_TIMESTAMP_STAGE} {
+			work := &pb.Work{File: "file://" + path, Since: since, TimestampField: field}
+			expected := &fakeWorkStream{ctx: context.Background()}
+			if err := newTestServer(nil).DoWork(work, expected); err != nil {
+				t.Fatal(err)
+			}
+			seeked := &fakeWorkStream{ctx: context.Background()}
+			if err := indexed.DoWork(work, seeked); err != nil {
+				t.Fatal(err)
+			}
+			if len(seeked.lines()) != len(expected.lines()) {
+				t.Errorf("Since %vs by %v: expected %v lines, got %v", seconds, field, len(expected.lines()), len(seeked.lines()))
+			}
+		}
+	}
+}
+
+func mustParseObjectPath(t *testing.T, objectPath string) *url.URL {
+	location, err := newTestServer(nil).parseObjectPath("", objectPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location
+}
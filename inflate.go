@@ -0,0 +1,629 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/bits"
+)
+
+// The standard library cannot report where deflate blocks start, which is
+// what a checkpoint index needs. gzipDecoder is a small table-driven
+// inflater in the spirit of zlib's puff that tracks the exact bit position
+// of every deflate block, so the index can be built with it, and can
+// resume from any of them, see resumeGzipDecoder. It handles concatenated
+// gzip members like gzip.Reader does.
+
+const (
+	windowSize = 1 << 15
+	windowMask = windowSize - 1
+	// maxChunk is how much output a Read call decodes at most.
+	maxChunk = 1 << 16
+
+	maxCodeBits  = 15
+	maxLitCodes  = 286
+	maxDistCodes = 30
+	// Codes of up to fastBits bits are decoded with a single lookup.
+	fastBits = 9
+	fastMask = 1<<fastBits - 1
+)
+
+var errCorruptDeflate = errors.New("corrupt deflate stream")
+
+// gzipDecoder decompresses a gzip object, reporting block starts to
+// onBlock so restart points can be recorded.
+type gzipDecoder struct {
+	r *bufio.Reader
+	// bitBuf holds bitCnt bits read ahead of what was consumed.
+	bitBuf uint64
+	bitCnt uint
+	// in is the number of compressed bits consumed.
+	in int64
+	// out is the number of uncompressed bytes produced.
+	out int64
+
+	window  [windowSize]byte
+	history int
+	pending []byte
+
+	inMember  bool
+	inBlock   bool
+	lastBlock bool
+	stored    int
+	lit, dist huffman
+
+	crc       uint32
+	memberOut uint32
+	// resumed is set when decoding started within the member, which is
+	// then the only one read.
+	resumed bool
+
+	// onBlock is called with the bit position and output offset at the
+	// start of every deflate block.
+	onBlock func(in, out int64)
+	// onMember is called with the byte offset of every gzip member.
+	onMember func(offset int64)
+}
+
+func newGzipDecoder(reader io.Reader) *gzipDecoder {
+	return &gzipDecoder{r: bufio.NewReader(reader)}
+}
+
+// resumeGzipDecoder inflates the rest of a gzip member from a deflate
+// block starting at bit in%8 of reader, where reader starts at byte in/8
+// of the object and window is the output preceding the block. Like zlib's
+// inflatePrime, the leading bits of the first byte are dropped. It ends
+// with the member, whose checksum is not known and so not checked.
+func resumeGzipDecoder(reader io.Reader, in int64, window []byte) (*gzipDecoder, error) {
+	d := &gzipDecoder{r: bufio.NewReader(reader), in: in - in%8, inMember: true, resumed: true}
+	if _, err := d.bits(uint(in % 8)); err != nil {
+		return nil, err
+	}
+	if len(window) > windowSize {
+		window = window[len(window)-windowSize:]
+	}
+	d.history = copy(d.window[:], window)
+	return d, nil
+}
+
+func (d *gzipDecoder) Read(p []byte) (int, error) {
+	for len(d.pending) == 0 {
+		if err := d.step(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	return n, nil
+}
+
+// step decodes up to maxChunk bytes of output, a member header or a
+// member trailer. The checksum is updated once per step.
+func (d *gzipDecoder) step() error {
+	d.pending = d.pending[:0]
+	if d.resumed && !d.inMember {
+		return io.EOF
+	}
+	var err error
+	switch {
+	case !d.inMember:
+		err = d.readHeader()
+	case !d.inBlock && d.lastBlock:
+		err = d.readTrailer()
+	case !d.inBlock:
+		err = d.readBlockHeader()
+	case d.lit.count == nil:
+		err = d.copyStored()
+	default:
+		err = d.inflateBlock()
+	}
+	d.out += int64(len(d.pending))
+	d.crc = crc32.Update(d.crc, crc32.IEEETable, d.pending)
+	d.memberOut += uint32(len(d.pending))
+	return err
+}
+
+func (d *gzipDecoder) readHeader() error {
+	d.alignToByte()
+	offset := d.in / 8
+	if d.bitCnt == 0 {
+		if err := d.fill(); d.bitCnt == 0 {
+			if err == io.EOF && offset != 0 {
+				return io.EOF
+			}
+			return unexpectedEOF(err)
+		}
+	}
+	var header [10]byte
+	for i := range header {
+		b, err := d.readAlignedByte()
+		if err != nil {
+			return err
+		}
+		header[i] = b
+	}
+	if header[0] != 0x1f || header[1] != 0x8b || header[2] != 8 {
+		return fmt.Errorf("invalid gzip header at byte %d", offset)
+	}
+	flags := header[3]
+	if flags&0x04 != 0 {
+		lo, err := d.readAlignedByte()
+		if err != nil {
+			return err
+		}
+		hi, err := d.readAlignedByte()
+		if err != nil {
+			return err
+		}
+		if err := d.skipBytes(int(lo) | int(hi)<<8); err != nil {
+			return err
+		}
+	}
+	for _, flag := range []byte{0x08, 0x10} {
+		if flags&flag == 0 {
+			continue
+		}
+		for {
+			b, err := d.readAlignedByte()
+			if err != nil {
+				return err
+			}
+			if b == 0 {
+				break
+			}
+		}
+	}
+	if flags&0x02 != 0 {
+		if err := d.skipBytes(2); err != nil {
+			return err
+		}
+	}
+
+	if d.onMember != nil {
+		d.onMember(offset)
+	}
+	d.inMember, d.lastBlock = true, false
+	d.crc, d.memberOut, d.history = 0, 0, 0
+	return nil
+}
+
+func (d *gzipDecoder) readTrailer() error {
+	d.alignToByte()
+	var trailer [8]byte
+	for i := range trailer {
+		b, err := d.readAlignedByte()
+		if err != nil {
+			return err
+		}
+		trailer[i] = b
+	}
+	crc := uint32(trailer[0]) | uint32(trailer[1])<<8 | uint32(trailer[2])<<16 | uint32(trailer[3])<<24
+	size := uint32(trailer[4]) | uint32(trailer[5])<<8 | uint32(trailer[6])<<16 | uint32(trailer[7])<<24
+	if !d.resumed && (crc != d.crc || size != d.memberOut) {
+		return errors.New("gzip checksum mismatch")
+	}
+	d.inMember = false
+	return nil
+}
+
+func (d *gzipDecoder) readBlockHeader() error {
+	if d.onBlock != nil {
+		d.onBlock(d.in, d.out)
+	}
+	header, err := d.bits(3)
+	if err != nil {
+		return err
+	}
+	d.lastBlock = header&1 == 1
+	switch header >> 1 {
+	case 0:
+		d.alignToByte()
+		var length [4]byte
+		for i := range length {
+			if length[i], err = d.readAlignedByte(); err != nil {
+				return err
+			}
+		}
+		n := int(length[0]) | int(length[1])<<8
+		if n != ^(int(length[2])|int(length[3])<<8)&0xffff {
+			return errCorruptDeflate
+		}
+		d.stored, d.lit.count = n, nil
+	case 1:
+		d.lit, d.dist = fixedLit, fixedDist
+	case 2:
+		if err := d.readDynamicTables(); err != nil {
+			return err
+		}
+	default:
+		return errCorruptDeflate
+	}
+	d.inBlock = true
+	return nil
+}
+
+// copyStored copies a stored block, first from the bits read ahead and
+// then straight from the input.
+func (d *gzipDecoder) copyStored() error {
+	for d.stored > 0 && d.bitCnt >= 8 && len(d.pending) < maxChunk {
+		b, _ := d.readAlignedByte()
+		d.emit(b)
+		d.stored--
+	}
+	if n := d.stored; n > 0 && len(d.pending) < maxChunk {
+		if n > maxChunk-len(d.pending) {
+			n = maxChunk - len(d.pending)
+		}
+		start := len(d.pending)
+		d.pending = append(d.pending, make([]byte, n)...)
+		if _, err := io.ReadFull(d.r, d.pending[start:]); err != nil {
+			return unexpectedEOF(err)
+		}
+		for _, b := range d.pending[start:] {
+			d.window[d.history&windowMask] = b
+			d.history++
+		}
+		d.in += int64(n) * 8
+		d.stored -= n
+	}
+	if d.stored == 0 {
+		d.inBlock = false
+	}
+	return nil
+}
+
+var (
+	lengthBase  = [29]int{3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31, 35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 258}
+	lengthExtra = [29]uint{0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 0}
+	distBase    = [30]int{1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193, 257, 385, 513, 769, 1025, 1537, 2049, 3073, 4097, 6145, 8193, 12289, 16385, 24577}
+	distExtra   = [30]uint{0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6, 7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13}
+)
+
+func (d *gzipDecoder) inflateBlock() error {
+	for len(d.pending) < maxChunk {
+		symbol, err := d.decode(&d.lit)
+		if err != nil {
+			return err
+		}
+		if symbol < 256 {
+			d.emit(byte(symbol))
+			continue
+		}
+		if symbol == 256 {
+			d.inBlock = false
+			return nil
+		}
+
+		symbol -= 257
+		if symbol >= len(lengthBase) {
+			return errCorruptDeflate
+		}
+		extra, err := d.bits(lengthExtra[symbol])
+		if err != nil {
+			return err
+		}
+		length := lengthBase[symbol] + int(extra)
+
+		symbol, err = d.decode(&d.dist)
+		if err != nil {
+			return err
+		}
+		if symbol >= len(distBase) {
+			return errCorruptDeflate
+		}
+		if extra, err = d.bits(distExtra[symbol]); err != nil {
+			return err
+		}
+		distance := distBase[symbol] + int(extra)
+		if distance > d.history || distance > windowSize {
+			return errCorruptDeflate
+		}
+		d.copyMatch(distance, length)
+	}
+	return nil
+}
+
+func (d *gzipDecoder) emit(b byte) {
+	d.window[d.history&windowMask] = b
+	d.history++
+	d.pending = append(d.pending, b)
+}
+
+// copyMatch repeats length bytes from distance back, in chunks that
+// neither overlap nor wrap around the window.
+func (d *gzipDecoder) copyMatch(distance, length int) {
+	for length > 0 {
+		from, to := (d.history-distance)&windowMask, d.history&windowMask
+		n := length
+		if n > distance {
+			n = distance
+		}
+		if n > windowSize-from {
+			n = windowSize - from
+		}
+		if n > windowSize-to {
+			n = windowSize - to
+		}
+		copy(d.window[to:to+n], d.window[from:from+n])
+		d.pending = append(d.pending, d.window[to:to+n]...)
+		d.history += n
+		length -= n
+	}
+}
+
+// windowContent returns up to the last 32KiB of output, oldest first.
+func (d *gzipDecoder) windowContent() []byte {
+	n := d.history
+	if n > windowSize {
+		n = windowSize
+	}
+	window := make([]byte, n)
+	for i := range window {
+		window[i] = d.window[(d.history-n+i)&windowMask]
+	}
+	return window
+}
+
+// huffman is a canonical Huffman code as counts of codes per length and
+// symbols ordered by code. fast maps the next fastBits input bits to the
+// symbol and length of a code of up to that length, or to zero.
+type huffman struct {
+	count  []int
+	symbol []int
+	fast   []uint16
+}
+
+var fixedLit, fixedDist = fixedTables()
+
+func fixedTables() (huffman, huffman) {
+	var lengths [maxLitCodes + 2 + maxDistCodes]int
+	for i := 0; i < 288; i++ {
+		switch {
+		case i < 144:
+			lengths[i] = 8
+		case i < 256:
+			lengths[i] = 9
+		case i < 280:
+			lengths[i] = 7
+		default:
+			lengths[i] = 8
+		}
+	}
+	for i := 288; i < len(lengths); i++ {
+		lengths[i] = 5
+	}
+	lit, _ := newHuffman(lengths[:288])
+	dist, _ := newHuffman(lengths[288:])
+	return lit, dist
+}
+
+func newHuffman(lengths []int) (huffman, error) {
+	h := huffman{count: make([]int, maxCodeBits+1), symbol: make([]int, len(lengths))}
+	for _, length := range lengths {
+		h.count[length]++
+	}
+	left := 1
+	for length := 1; length <= maxCodeBits; length++ {
+		left = left<<1 - h.count[length]
+		if left < 0 {
+			return h, errCorruptDeflate
+		}
+	}
+	offsets := make([]int, maxCodeBits+2)
+	for length := 1; length <= maxCodeBits; length++ {
+		offsets[length+1] = offsets[length] + h.count[length]
+	}
+	for symbol, length := range lengths {
+		if length != 0 {
+			h.symbol[offsets[length]] = symbol
+			offsets[length]++
+		}
+	}
+
+	// Codes are sent most significant bit first, so their bits are
+	// reversed to index the table with input bits.
+	h.fast = make([]uint16, 1<<fastBits)
+	var next [maxCodeBits + 1]int
+	code := 0
+	for length := 1; length <= fastBits; length++ {
+		next[length] = code
+		code = (code + h.count[length]) << 1
+	}
+	for symbol, length := range lengths {
+		if length == 0 || length > fastBits {
+			continue
+		}
+		reversed := int(bits.Reverse16(uint16(next[length])) >> (16 - uint(length)))
+		next[length]++
+		for i := reversed; i < len(h.fast); i += 1 << uint(length) {
+			h.fast[i] = uint16(symbol<<4 | length)
+		}
+	}
+	return h, nil
+}
+
+var codeLengthOrder = [19]int{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15}
+
+func (d *gzipDecoder) readDynamicTables() error {
+	counts, err := d.bits(14)
+	if err != nil {
+		return err
+	}
+	nlen, ndist, ncode := int(counts&0x1f)+257, int(counts>>5&0x1f)+1, int(counts>>10)+4
+	if nlen > maxLitCodes || ndist > maxDistCodes {
+		return errCorruptDeflate
+	}
+
+	var lengths [maxLitCodes + maxDistCodes]int
+	for i := 0; i < ncode; i++ {
+		length, err := d.bits(3)
+		if err != nil {
+			return err
+		}
+		lengths[codeLengthOrder[i]] = int(length)
+	}
+	codes, err := newHuffman(lengths[:19])
+	if err != nil {
+		return err
+	}
+
+	for i := range lengths {
+		lengths[i] = 0
+	}
+	for i := 0; i < nlen+ndist; {
+		symbol, err := d.decode(&codes)
+		if err != nil {
+			return err
+		}
+		if symbol < 16 {
+			lengths[i] = symbol
+			i++
+			continue
+		}
+		var repeat uint32
+		length := 0
+		switch symbol {
+		case 16:
+			if i == 0 {
+				return errCorruptDeflate
+			}
+			length = lengths[i-1]
+			repeat, err = d.bits(2)
+			repeat += 3
+		case 17:
+			repeat, err = d.bits(3)
+			repeat += 3
+		default:
+			repeat, err = d.bits(7)
+			repeat += 11
+		}
+		if err != nil {
+			return err
+		}
+		if i+int(repeat) > nlen+ndist {
+			return errCorruptDeflate
+		}
+		for ; repeat > 0; repeat-- {
+			lengths[i] = length
+			i++
+		}
+	}
+	if lengths[256] == 0 {
+		return errCorruptDeflate
+	}
+
+	// Incomplete codes are allowed, but only used codes may appear.
+	if d.lit, err = newHuffman(lengths[:nlen]); err != nil {
+		return err
+	}
+	d.dist, err = newHuffman(lengths[nlen : nlen+ndist])
+	return err
+}
+
+// decode reads one symbol, looking short codes up in the fast table and
+// reading longer ones a bit at a time.
+func (d *gzipDecoder) decode(h *huffman) (int, error) {
+	if d.bitCnt < fastBits {
+		// Near the end of the input fewer bits may be left, which is
+		// fine for codes short enough.
+		d.fill()
+	}
+	if entry := h.fast[d.bitBuf&fastMask]; entry != 0 {
+		if length := uint(entry & 15); length <= d.bitCnt {
+			d.consume(length)
+			return int(entry >> 4), nil
+		}
+	}
+
+	code, first, index := 0, 0, 0
+	for length := 1; length <= maxCodeBits; length++ {
+		bit, err := d.bits(1)
+		if err != nil {
+			return 0, err
+		}
+		code |= int(bit)
+		count := h.count[length]
+		if code-first < count {
+			return h.symbol[index+code-first], nil
+		}
+		index += count
+		first = (first + count) << 1
+		code <<= 1
+	}
+	return 0, errCorruptDeflate
+}
+
+// fill reads whole bytes ahead while the bit buffer has room. Running out
+// of input is only an error once bits are missing.
+func (d *gzipDecoder) fill() error {
+	for d.bitCnt <= 56 {
+		b, err := d.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		d.bitBuf |= uint64(b) << d.bitCnt
+		d.bitCnt += 8
+	}
+	return nil
+}
+
+// bits reads n bits, least significant first.
+func (d *gzipDecoder) bits(n uint) (uint32, error) {
+	if d.bitCnt < n {
+		if err := d.fill(); d.bitCnt < n {
+			return 0, unexpectedEOF(err)
+		}
+	}
+	value := uint32(d.bitBuf & (1<<n - 1))
+	d.consume(n)
+	return value, nil
+}
+
+func (d *gzipDecoder) consume(n uint) {
+	d.bitBuf >>= n
+	d.bitCnt -= n
+	d.in += int64(n)
+}
+
+func (d *gzipDecoder) alignToByte() {
+	d.consume(d.bitCnt % 8)
+}
+
+func (d *gzipDecoder) readAlignedByte() (byte, error) {
+	b, err := d.bits(8)
+	return byte(b), err
+}
+
+func (d *gzipDecoder) skipBytes(n int) error {
+	for ; n > 0; n-- {
+		if _, err := d.readAlignedByte(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
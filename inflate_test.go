@@ -0,0 +1,185 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+
+	"github.com/klauspost/pgzip"
+)
+
+func TestGzipDecoder(t *testing.T) {
+	content := []byte(auditLog(2000))
+	named := compressLevel(t, content[:1000], gzip.DefaultCompression)
+	named[3] |= 0x08
+	named = append(named[:10], append([]byte("audit.log\x00"), named[10:]...)...)
+	for _, test := range []struct {
+		name       string
+		compressed []byte
+		expected   []byte
+	}{
+		{"default", compressLevel(t, content, gzip.DefaultCompression), content},
+		{"stored", compressLevel(t, content, gzip.NoCompression), content},
+		{"huffman only", compressLevel(t, content, gzip.HuffmanOnly), content},
+		{"best", compressLevel(t, content, gzip.BestCompression), content},
+		{"empty", compressLevel(t, nil, gzip.DefaultCompression), nil},
+		{"multiple members", append(compressLevel(t, content[:1000], gzip.BestSpeed), compressLevel(t, content[1000:], gzip.NoCompression)...), content},
+		{"file name", named, content[:1000]},
+	} {
+		decompressed, err := ioutil.ReadAll(newGzipDecoder(bytes.NewReader(test.compressed)))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(decompressed, test.expected) {
+			t.Errorf("%s: decompressed %v bytes, expected %v", test.name, len(decompressed), len(test.expected))
+		}
+	}
+}
+
+func TestGzipDecoderCorruptContent(t *testing.T) {
+	compressed := compressLevel(t, []byte(line1), gzip.DefaultCompression)
+	checksum := append([]byte{}, compressed...)
+	checksum[len(checksum)-8]++
+	for _, test := range []struct {
+		name       string
+		compressed []byte
+	}{
+		{"checksum", checksum},
+		{"truncated", compressed[:len(compressed)-4]},
+		{"not gzip", []byte(line1)},
+		{"trailing garbage", append(append([]byte{}, compressed...), "garbage"...)},
+	} {
+		if _, err := ioutil.ReadAll(newGzipDecoder(bytes.NewReader(test.compressed))); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
+
+func TestResumeGzipDecoder(t *testing.T) {
+	content := []byte(auditLog(5000))
+	half := len(content) / 2
+	for _, test := range []struct {
+		name       string
+		compressed []byte
+	}{
+		{"default", append(compressLevel(t, content[:half], gzip.DefaultCompression), compressLevel(t, content[half:], gzip.DefaultCompression)...)},
+		{"stored", append(compressLevel(t, content[:half], gzip.NoCompression), compressLevel(t, content[half:], gzip.NoCompression)...)},
+		{"huffman only", append(compressLevel(t, content[:half], gzip.HuffmanOnly), compressLevel(t, content[half:], gzip.HuffmanOnly)...)},
+		{"flushed", compressFlushed(t, content, 3000)},
+		{"pgzip", compressParallel(t, content)},
+	} {
+		type block struct {
+			in, out int64
+			window  []byte
+			member  int
+		}
+		var blocks []block
+		// memberEnds holds the output offset each member ends at.
+		var memberEnds []int64
+		decoder := newGzipDecoder(bytes.NewReader(test.compressed))
+		decoder.onBlock = func(in, out int64) {
+			blocks = append(blocks, block{in, out, decoder.windowContent(), len(memberEnds)})
+		}
+		decoder.onMember = func(offset int64) {
+			if offset != 0 {
+				memberEnds = append(memberEnds, decoder.out)
+			}
+		}
+		if _, err := ioutil.ReadAll(decoder); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		memberEnds = append(memberEnds, int64(len(content)))
+		if len(blocks) < 4 {
+			t.Fatalf("%s: expected several blocks, got %v", test.name, len(blocks))
+		}
+
+		for _, b := range blocks {
+			resumed, err := resumeGzipDecoder(bytes.NewReader(test.compressed[b.in/8:]), b.in, b.window)
+			if err != nil {
+				t.Fatalf("%s: resuming at bit %v: %v", test.name, b.in, err)
+			}
+			rest, err := ioutil.ReadAll(resumed)
+			if err != nil {
+				t.Fatalf("%s: resuming at bit %v: %v", test.name, b.in, err)
+			}
+			// Reading ends with the member.
+			if !bytes.Equal(rest, content[b.out:memberEnds[b.member]]) {
+				t.Fatalf("%s: resuming at bit %v returned different content", test.name, b.in)
+			}
+		}
+	}
+}
+
+func compressLevel(t *testing.T, content []byte, level int) []byte {
+	var buffer bytes.Buffer
+	writer, err := gzip.NewWriterLevel(&buffer, level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+// compressFlushed flushes the writer every chunk bytes, which ends blocks
+// with an empty stored block, as network writers do.
+func compressFlushed(t *testing.T, content []byte, chunk int) []byte {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	for len(content) > 0 {
+		n := chunk
+		if n > len(content) {
+			n = len(content)
+		}
+		if _, err := writer.Write(content[:n]); err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		content = content[n:]
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+// compressParallel compresses like pgzip writers do, in blocks that each
+// end with an empty stored block.
+func compressParallel(t *testing.T, content []byte) []byte {
+	var buffer bytes.Buffer
+	writer := pgzip.NewWriter(&buffer)
+	if err := writer.SetConcurrency(1<<16, 4); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
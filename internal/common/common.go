@@ -0,0 +1,40 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package common holds helpers shared by the worker and the coordinator.
+package common
+
+import (
+	"strings"
+	"time"
+
+	log "k8s.io/klog"
+)
+
+// GlobCharacters start the pattern part of object paths.
+const GlobCharacters = "*?["
+
+// IsObjectPattern reports whether objectPath is a prefix, ending with "/",
+// or a glob pattern rather than a single object.
+func IsObjectPattern(objectPath string) bool {
+	return strings.HasSuffix(objectPath, "/") || strings.ContainsAny(objectPath, GlobCharacters)
+}
+
+// TimeTrack logs how long name took since start.
+func TimeTrack(start time.Time, name string) {
+	elapsed := time.Since(start)
+	log.Infof("%s took %s", name, elapsed)
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	pb "github.com/kzmrv/gcsreader/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newSampler builds a predicate keeping a deterministic sample of lines.
+// It returns nil without sampling.
+func newSampler(sampling *pb.Sampling) (linePredicate, error) {
+	if sampling == nil {
+		return nil, nil
+	}
+	if sampling.Rate <= 0 || sampling.Rate > 1 {
+		return nil, fmt.Errorf("sampling rate %v is not in (0, 1]", sampling.Rate)
+	}
+	if sampling.Rate == 1 {
+		return nil, nil
+	}
+
+	threshold := sampling.Rate * math.MaxUint64
+	keep := func(key []byte) bool {
+		hash := sha256.Sum256(key)
+		return float64(binary.BigEndian.Uint64(hash[:8])) < threshold
+	}
+	switch sampling.Mode {
+	case pb.SamplingMode_SAMPLING_RANDOM:
+		// Lines are drawn by where they are rather than in reading order,
+		// so requests resumed from a cursor keep the same sample.
+		return func(e *logEntry) bool {
+			key := make([]byte, 16, 16+len(e.source))
+			binary.BigEndian.PutUint64(key, uint64(sampling.Seed))
+			binary.BigEndian.PutUint64(key[8:], uint64(e.position.lineNumber))
+			return keep(append(key, e.source...))
+		}, nil
+	case pb.SamplingMode_SAMPLING_AUDIT_ID:
+		seed := make([]byte, 8)
+		binary.BigEndian.PutUint64(seed, uint64(sampling.Seed))
+		return func(e *logEntry) bool {
+			return keep(append(seed[:8:8], e.event.AuditID...))
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown sampling mode %v", sampling.Mode)
+}
+
+// resultLimit tracks returned lines against the maxLines and maxBytes of a
+// request. Zero limits are unlimited.
+type resultLimit struct {
+	maxLines int64
+	maxBytes int64
+	lines    int64
+	bytes    int64
+}
+
+// admit counts a line of size bytes and reports whether it fits in the
+// limits. Once a line does not fit, no further lines are wanted.
+func (l *resultLimit) admit(size int) bool {
+	if (l.maxLines > 0 && l.lines >= l.maxLines) || (l.maxBytes > 0 && l.bytes+int64(size) > l.maxBytes) {
+		return false
+	}
+	l.lines++
+	l.bytes += int64(size)
+	return true
+}
+
+// requestLimiter holds a slot for each request being served. Requests
+// finding no free slot fail with ResourceExhausted rather than wait, so
+// clients such as the coordinator can try another worker.
+type requestLimiter chan struct{}
+
+func (l requestLimiter) acquire() error {
+	select {
+	case l <- struct{}{}:
+		return nil
+	default:
+		return status.Errorf(codes.ResourceExhausted, "already serving %d requests", cap(l))
+	}
+}
+
+func (l requestLimiter) release() {
+	<-l
+}
+
+func (l requestLimiter) unary(ctx context.Context, request interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := l.acquire(); err != nil {
+		return nil, err
+	}
+	defer l.release()
+	return handler(ctx, request)
+}
+
+func (l requestLimiter) stream(server interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := l.acquire(); err != nil {
+		return err
+	}
+	defer l.release()
+	return handler(server, stream)
+}
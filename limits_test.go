@@ -0,0 +1,139 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	pb "github.com/kzmrv/gcsreader/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRandomSampling(t *testing.T) {
+	sample := func(seed int64) []bool {
+		sampler, err := newSampler(&pb.Sampling{Mode: pb.SamplingMode_SAMPLING_RANDOM, Rate: 0.1, Seed: seed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		kept := make([]bool, 1000)
+		for i := range kept {
+			kept[i] = sampler(&logEntry{source: "audit.log", position: linePosition{lineNumber: int64(i + 1)}})
+		}
+		return kept
+	}
+
+	first, second := sample(42), sample(42)
+	count := 0
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("Expected the same sample for the same seed, line %v differs", i)
+		}
+		if first[i] {
+			count++
+		}
+	}
+	if count < 50 || count > 150 {
+		t.Fatalf("Expected about 100 sampled lines, got %v", count)
+	}
+}
+
+func TestAuditIDSampling(t *testing.T) {
+	sampler, err := newSampler(&pb.Sampling{Mode: pb.SamplingMode_SAMPLING_AUDIT_ID, Rate: 0.5, Seed: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for i := 0; i < 1000; i++ {
+		auditID := fmt.Sprintf("request-%d", i)
+		kept := sampler(&logEntry{event: &auditEvent{AuditID: auditID, Stage: "RequestReceived"}})
+		if sampler(&logEntry{event: &auditEvent{AuditID: auditID, Stage: "ResponseComplete"}}) != kept {
+			t.Fatalf("Expected all stages of %s to be sampled alike", auditID)
+		}
+		if kept {
+			count++
+		}
+	}
+	if count < 400 || count > 600 {
+		t.Fatalf("Expected about 500 sampled requests, got %v", count)
+	}
+}
+
+func TestBadSampling(t *testing.T) {
+	for _, sampling := range []*pb.Sampling{
+		{Rate: 0},
+		{Rate: 1.5},
+		{Mode: pb.SamplingMode(42), Rate: 0.5},
+	} {
+		if _, err := newSampler(sampling); err == nil {
+			t.Errorf("Expected error for %v", sampling)
+		}
+	}
+}
+
+func TestDoWorkLimits(t *testing.T) {
+	path := writeTempFile(t, "audit.log", []byte(strings.Repeat(line2+"\n", 1000)))
+	defer os.RemoveAll(filepath.Dir(path))
+
+	for _, test := range []struct {
+		work     *pb.Work
+		expected int
+	}{
+		{&pb.Work{MaxLines: 150}, 150},
+		{&pb.Work{MaxBytes: int64(len(line2) * 5 / 2)}, 2},
+		{&pb.Work{MaxLines: 2000}, 1000},
+	} {
+		test.work.File = "file://" + path
+		stream := &fakeWorkStream{ctx: context.Background()}
+		if err := newTestServer(nil).DoWork(test.work, stream); err != nil {
+			t.Fatal(err)
+		}
+		if lines := stream.lines(); len(lines) != test.expected {
+			t.Errorf("Expected %v lines, got %v", test.expected, len(lines))
+		}
+		summary := stream.results[len(stream.results)-1].Summary
+		if limited := test.expected != 1000; summary.GetLimitReached() != limited {
+			t.Errorf("Expected limit reached to be %v, got %v", limited, summary)
+		}
+	}
+}
+
+func TestRequestLimiter(t *testing.T) {
+	limiter := make(requestLimiter, 1)
+	served := 0
+	handler := func(interface{}, grpc.ServerStream) error {
+		served++
+		// A request arriving while this one is served is refused.
+		return limiter.stream(nil, nil, nil, func(interface{}, grpc.ServerStream) error {
+			t.Fatal("Expected the second request to be refused")
+			return nil
+		})
+	}
+	if err := limiter.stream(nil, nil, nil, handler); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("Expected ResourceExhausted, got %v", err)
+	}
+	// The slot is free again once the request is done.
+	if err := limiter.stream(nil, nil, nil, func(interface{}, grpc.ServerStream) error { served++; return nil }); err != nil || served != 2 {
+		t.Fatalf("Expected the request to be served, got %v", err)
+	}
+}
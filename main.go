@@ -18,172 +18,490 @@ package main
 
 import (
 	"context"
+	"flag"
 	"io"
 	"net"
+	"net/http"
+	"net/url"
 	"os"
-	"path/filepath"
 	"regexp"
-	"strings"
 	"time"
 
 	"github.com/golang/protobuf/ptypes"
 
-	"cloud.google.com/go/storage"
 	ts "github.com/golang/protobuf/ptypes/timestamp"
-	gzip "github.com/klauspost/pgzip"
+	"github.com/kzmrv/gcsreader/internal/common"
 	pb "github.com/kzmrv/gcsreader/proto"
-	"google.golang.org/api/option"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	log "k8s.io/klog"
+	"sigs.k8s.io/yaml"
 )
 
-const (
-	port       = ":17654"
-	bucketName = "kubernetes-jenkins"
-	lineBuffer = 100000
-)
+// maxMalformedSamples limits the malformed lines streamed per request.
+const maxMalformedSamples = 100
+
+var dumpConfig = flag.Bool("dump-config", false, "Print the effective configuration as YAML and exit")
+
+type serverType struct {
+	// defaultBucket is read from by object paths without a bucket.
+	defaultBucket string
+	allowlist     *sourceAllowlist
+	sources       map[string]objectSource
+	// indexes is nil when indexing is disabled.
+	indexes *indexStore
+	// lineBuffer and orderedBuffer size the channels of lines read ahead,
+	// for all objects of a request and for each object in ordered mode.
+	lineBuffer    int
+	orderedBuffer int
+	// maxOrderedObjects bounds the objects, and so the streams, read at
+	// once by an ordered request.
+	maxOrderedObjects int
+	batchSize         int
+}
 
-type serverType struct{}
+func newServer(config *serverConfig, allowlist *sourceAllowlist, sources map[string]objectSource, indexes *indexStore) *serverType {
+	return &serverType{
+		defaultBucket:     config.DefaultBucket,
+		allowlist:         allowlist,
+		sources:           sources,
+		indexes:           indexes,
+		lineBuffer:        config.LineBuffer,
+		orderedBuffer:     config.OrderedBuffer,
+		maxOrderedObjects: config.MaxOrderedObjects,
+		batchSize:         config.BatchSize,
+	}
+}
 
 type lineFilter struct {
-	regex *regexp.Regexp
-	since time.Time
-	until time.Time
+	regex     *regexp.Regexp
+	since     time.Time
+	until     time.Time
+	timestamp timestampSelector
+	event     eventPredicate
+	// sample goes after the other predicates, so it only sees lines
+	// passing every filter.
+	sample      linePredicate
+	errorPolicy pb.ErrorPolicy
+	cursor      *resumeCursor
+	// seekSince is since when it bounds timestamps a checkpoint index can
+	// skip lines by, which are the received and stage ones.
+	seekSince time.Time
 }
 
 func main() {
 	log.InitFlags(nil)
+	config, err := parseConfig(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatalf("Bad configuration: %v", err)
+	}
+	if *dumpConfig {
+		data, err := yaml.Marshal(config)
+		if err != nil {
+			log.Fatalf("Failed to print the configuration: %v", err)
+		}
+		os.Stdout.Write(data)
+		return
+	}
+	gcsClient, err := newGCSClient(context.Background(), config.Credentials.Mode, config.Credentials.File)
+	if err != nil {
+		log.Fatalf("Failed to create storage client: %v", err)
+	}
+	defer gcsClient.Close()
 
-	listener, err := net.Listen("tcp", port)
+	serverOptions, err := config.serverOptions()
+	if err != nil {
+		log.Fatalf("Failed to configure the server: %v", err)
+	}
+	listener, err := net.Listen("tcp", config.ListenAddress)
 	if err != nil {
 		log.Fatalf("Failed to listen: %v", err)
 	}
-	log.Infof("Listening on port: %v", port)
-	server := grpc.NewServer()
-	pb.RegisterWorkerServer(server, &serverType{})
+	allowlist := newSourceAllowlist(config)
+	sources := newObjectSources(gcsClient, allowlist)
+	if config.Cache.Dir != "" {
+		cache, err := newObjectCache(config.Cache.Dir, config.Cache.MaxBytes)
+		if err != nil {
+			log.Fatalf("Failed to open the object cache: %v", err)
+		}
+		sources["gs"] = &cachedSource{objectSource: sources["gs"], cache: cache}
+	}
+	if config.MetricsAddress != "" {
+		go func() {
+			log.Fatal(http.ListenAndServe(config.MetricsAddress, nil))
+		}()
+	}
+
+	var indexes *indexStore
+	if config.IndexDir != "" {
+		if err := os.MkdirAll(config.IndexDir, 0755); err != nil {
+			log.Fatalf("Failed to create the index directory: %v", err)
+		}
+		indexes = newIndexStore(config.IndexDir)
+	}
+
+	log.Infof("Listening on: %v", config.ListenAddress)
+	server := grpc.NewServer(serverOptions...)
+	pb.RegisterWorkerServer(server, newServer(config, allowlist, sources, indexes))
 	err = server.Serve(listener)
 	if err != nil {
 		log.Fatalf("Failed to serve: %v", err)
 	}
 }
 
-func (*serverType) DoWork(request *pb.Work, server pb.Worker_DoWorkServer) error {
-	defer timeTrack(time.Now(), "Call duration")
-	log.Infof("Received: file %v, substring %v, since %v, until %v",
-		request.File, request.TargetSubstring, ptypes.TimestampString(request.Since), ptypes.TimestampString(request.Until))
+func (s *serverType) DoWork(request *pb.Work, server pb.Worker_DoWorkServer) error {
+	defer common.TimeTrack(time.Now(), "Call duration")
+	log.Infof("Received: bucket %v, file %v, files %v, compression %v, substring %v, query %v, since %v, until %v",
+		request.Bucket, request.File, request.Files, request.Compression, request.TargetSubstring, request.Query, ptypes.TimestampString(request.Since), ptypes.TimestampString(request.Until))
 
-	reader, err := downloadAndDecompress(request.File)
+	locations, filters, err := s.prepareWork(server.Context(), request)
 	if err != nil {
 		return err
 	}
-	lineChannel := make(chan *lineEntry, lineBuffer)
-	regex, err := regexp.Compile(request.TargetSubstring)
+	projection, err := parseProjection(request.Projection)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	options := &resultOptions{
+		projection:  projection,
+		errorPolicy: request.ErrorPolicy,
+		limit:       &resultLimit{maxLines: request.MaxLines, maxBytes: request.MaxBytes},
+		cursor:      request.Cursor,
+		noCursors:   request.Ordered || request.Deduplication != pb.Deduplication_DEDUPLICATION_NONE,
+		batchSize:   s.batchSize,
+	}
+	deduplicator, err := newDeduplicator(request)
 	if err != nil {
 		return err
 	}
 
-	since, _ := ptypes.Timestamp(request.Since)
-	until, _ := ptypes.Timestamp(request.Until)
+	// Cancelling stops the reading goroutine when the client goes away,
+	// sending fails or a limit is reached.
+	ctx, cancel := context.WithCancel(server.Context())
+	defer cancel()
+	lineChannel := make(chan *lineEntry, s.lineBuffer)
+	if request.Ordered {
+		window, err := reorderWindow(request)
+		if err != nil {
+			return err
+		}
+		if len(locations) > s.maxOrderedObjects {
+			return status.Errorf(codes.InvalidArgument, "ordered requests read at most %d objects, got %d", s.maxOrderedObjects, len(locations))
+		}
+		go s.readObjectsOrdered(ctx, locations, request.Compression, lineChannel, filters, window)
+	} else {
+		go s.readObjects(ctx, locations, request.Compression, lineChannel, filters)
+	}
+	if deduplicator != nil {
+		lines := lineChannel
+		lineChannel = make(chan *lineEntry, s.lineBuffer)
+		go deduplicator.run(ctx, lines, lineChannel)
+	}
+	return batchAndSend(lineChannel, server, options)
+}
+
+// resultOptions shape the results streamed for matching lines.
+type resultOptions struct {
+	projection  fieldProjection
+	errorPolicy pb.ErrorPolicy
+	limit       *resultLimit
+	// cursor is where the request resumes, returned until lines are sent.
+	cursor *pb.Cursor
+	// Lines ordered across objects or grouped by auditID cannot be resumed
+	// from a position.
+	noCursors bool
+	batchSize int
+}
+
+func (o *resultOptions) advance(cursor *pb.Cursor) {
+	if !o.noCursors {
+		o.cursor = cursor
+	}
+}
+
+// prepareWork resolves the objects a request reads and the filters their
+// lines have to pass.
+func (s *serverType) prepareWork(ctx context.Context, request *pb.Work) ([]*url.URL, *lineFilter, error) {
+	objectPaths := request.Files
+	if request.File != "" {
+		objectPaths = append([]string{request.File}, objectPaths...)
+	}
+	if len(objectPaths) == 0 {
+		return nil, nil, status.Error(codes.InvalidArgument, "no files requested")
+	}
+	locations, err := s.expandObjectPaths(ctx, request.Bucket, objectPaths)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	regex, err := regexp.Compile(request.TargetSubstring)
+	if err != nil {
+		return nil, nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	fieldFilter, err := newFieldFilter(request.Filters)
+	if err != nil {
+		return nil, nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if request.MaxLines < 0 || request.MaxBytes < 0 {
+		return nil, nil, status.Error(codes.InvalidArgument, "limits must not be negative")
+	}
+	sampler, err := newSampler(request.Sampling)
+	if err != nil {
+		return nil, nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	var query eventPredicate
+	if request.Query != "" {
+		if query, err = parseQuery(request.Query); err != nil {
+			return nil, nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	timestamp, err := newTimestampSelector(request.TimestampField, request.TimestampPath)
+	if err != nil {
+		return nil, nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	cursor, err := newResumeCursor(request.Cursor)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	filters := &lineFilter{
-		regex: regex,
-		since: since,
-		until: until,
+		regex:       regex,
+		timestamp:   timestamp,
+		event:       allOf(fieldFilter, query),
+		sample:      sampler,
+		errorPolicy: request.ErrorPolicy,
+		cursor:      cursor,
 	}
+	// An unset bound leaves the window open on that side.
+	if request.Since != nil {
+		if filters.since, err = ptypes.Timestamp(request.Since); err != nil {
+			return nil, nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if request.TimestampField != pb.TimestampField_TIMESTAMP_PATH {
+			filters.seekSince = filters.since
+		}
+	}
+	if request.Until != nil {
+		if filters.until, err = ptypes.Timestamp(request.Until); err != nil {
+			return nil, nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	return locations, filters, nil
+}
 
-	go getMatchingLines(reader, lineChannel, filters)
-	batchAndSend(lineChannel, server)
+func (s *serverType) ListFiles(ctx context.Context, request *pb.ListFilesRequest) (*pb.ListFilesResult, error) {
+	defer common.TimeTrack(time.Now(), "ListFiles duration")
+	log.Infof("Received: list bucket %v, prefix %v, glob %v", request.Bucket, request.Prefix, request.Glob)
 
-	return nil
+	pattern, err := s.parseObjectPath(request.Bucket, request.Prefix+request.Glob)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := s.allowlist.check(pattern); err != nil {
+		return nil, err
+	}
+	objects, err := s.listMatching(ctx, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &pb.ListFilesResult{Files: make([]*pb.FileInfo, len(objects))}
+	for i, object := range objects {
+		updated, _ := ptypes.TimestampProto(object.updated)
+		result.Files[i] = &pb.FileInfo{
+			Name:            objectName(object.location),
+			Size:            object.size,
+			Generation:      object.generation,
+			ContentEncoding: object.contentEncoding,
+			Updated:         updated,
+		}
+	}
+	return result, nil
 }
 
-func batchAndSend(ch chan *lineEntry, server pb.Worker_DoWorkServer) {
+// readObjects streams matching lines of every object into ch, one object
+// after another, and stops at the first object that cannot be read.
+func (s *serverType) readObjects(ctx context.Context, locations []*url.URL, compression pb.Compression, ch chan *lineEntry, filters *lineFilter) {
+	defer close(ch)
+	for _, location := range locations {
+		log.Infof("Reading %v", location)
+		if err := s.readObject(ctx, location, compression, ch, filters); err != nil {
+			sendLine(ctx, ch, &lineEntry{err: err})
+			return
+		}
+	}
+	if err := filters.cursor.check(); err != nil {
+		sendLine(ctx, ch, &lineEntry{err: err})
+	}
+}
+
+// readObject streams matching lines of a single object, or of the archive
+// members selected by the location fragment, into ch.
+func (s *serverType) readObject(ctx context.Context, location *url.URL, compression pb.Compression, ch chan *lineEntry, filters *lineFilter) error {
+	if filters.cursor.skipObject(location) {
+		log.Infof("Skipping %v before the cursor", location)
+		return nil
+	}
+	if location.Fragment != "" {
+		return s.readArchiveMembers(ctx, location, compression, ch, filters)
+	}
+	source := location.String()
+	start, _ := filters.cursor.start(source)
+	reader, position, err := s.openObject(ctx, location, compression, filters, start)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	if position.offset < start.offset {
+		if err := skipTo(reader, position, start); err != nil {
+			return err
+		}
+		position = start
+	}
+	return getMatchingLinesFrom(ctx, reader, ch, filters, source, position)
+}
+
+// batchAndSend streams lines from ch in batches and finishes with a
+// summary. It returns the error that stopped reading or sending, if any.
+func batchAndSend(ch chan *lineEntry, server pb.Worker_DoWorkServer, options *resultOptions) error {
 	lineCounter := 0
-	const batchSize = 100
+	summary := &pb.WorkSummary{}
+	var readErr, err error
 	for hasMoreBatches := true; hasMoreBatches; {
-		batches := make([]*pb.LogLine, batchSize)
+		batches := make([]*pb.LogLine, options.batchSize)
+		var malformed []*pb.MalformedLine
 		i := 0
-		for i < batchSize {
+		for i < options.batchSize {
 			line, hasMore := <-ch
-			if line.err == io.EOF || !hasMore {
+			if !hasMore {
 				hasMoreBatches = false
 				break
 			}
 			if line.err != nil {
-				log.Errorf("Failed to parse line with error %v", line.err)
+				// The producer stops at its first error.
+				log.Errorf("Failed to read lines with error %v", line.err)
+				readErr = line.err
+				continue
+			}
+			if line.scanned != nil {
+				summary.BytesRead += line.scanned.bytes
+				summary.LinesScanned += line.scanned.lines
+				continue
+			}
+			if line.malformed != nil {
+				options.advance(line.malformed.position.cursor(line.malformed.source))
+				summary.MalformedLines++
+				summary.SkippedLines++
+				if line.malformed.truncated {
+					summary.TruncatedLines++
+				}
+				if options.errorPolicy == pb.ErrorPolicy_ERROR_POLICY_REPORT && summary.MalformedLines <= maxMalformedSamples {
+					malformed = append(malformed, line.malformed.proto())
+				}
 				continue
 			}
 
+			summary.LinesMatched++
 			entry := line.logEntry
+			if entry.duplicate {
+				summary.DuplicateLines++
+				continue
+			}
+			if entry.late {
+				summary.LateLines++
+			}
+			cursor := entry.position.cursor(entry.source)
 			pbLine := &pb.LogLine{
-				Entry:     *entry.log,
-				Timestamp: &ts.Timestamp{Seconds: entry.time.Unix(), Nanos: int32(entry.time.Nanosecond())}}
+				Timestamp: &ts.Timestamp{Seconds: entry.time.Unix(), Nanos: int32(entry.time.Nanosecond())},
+				Source:    entry.source}
+			if latency, ok := entry.event.latency(); ok {
+				pbLine.Latency = ptypes.DurationProto(latency)
+			}
+			if entry.stages != nil {
+				pbLine.Stages = entry.stages.proto()
+			}
+			if len(options.projection) == 0 {
+				pbLine.Entry = *entry.log
+			} else if pbLine.Projection, err = options.projection.apply(*entry.log); err != nil {
+				log.Errorf("Failed to project line with error %v", err)
+				summary.SkippedLines++
+				options.advance(cursor)
+				continue
+			}
+			if !options.limit.admit(len(pbLine.Entry) + len(pbLine.Projection)) {
+				// Returning cancels reading the rest of the objects.
+				summary.LimitReached = true
+				hasMoreBatches = false
+				break
+			}
+			options.advance(cursor)
 
 			batches[i] = pbLine
 			i++
 		}
 
-		if i != 0 {
-			err := server.Send(&pb.WorkResult{LogLines: batches[:i]})
+		if i != 0 || len(malformed) != 0 {
+			err = server.Send(&pb.WorkResult{LogLines: batches[:i], MalformedLines: malformed, Cursor: options.cursor})
 			if err != nil {
 				log.Errorf("Failed to send result with: %v", err)
+				return err
 			}
 			lineCounter += i
 		}
 	}
 
-	log.Infof("Finished with %v lines", lineCounter)
-}
-
-func downloadAndDecompress(objectPath string) (io.Reader, error) {
-	//return loadFromLocalFS(objectPath)
-	reader, err := download(objectPath)
-	if err != nil {
-		return nil, err
+	if err := server.Context().Err(); readErr == nil && err != nil {
+		// Reading stops without an error entry once the client is gone.
+		readErr = status.FromContextError(err).Err()
 	}
-
-	decompressed, err := decompress(reader)
-	if err != nil {
-		return nil, err
+	if readErr != nil {
+		st := status.Convert(readErr)
+		summary.Code = int32(st.Code())
+		summary.Error = st.Message()
+	}
+	if err = server.Send(&pb.WorkResult{Summary: summary, Cursor: options.cursor}); err != nil {
+		log.Errorf("Failed to send summary with: %v", err)
+		return err
 	}
-	return decompressed, nil
+	log.Infof("Finished with %v lines, %v malformed", lineCounter, summary.MalformedLines)
+	return readErr
 }
 
-func download(objectPath string) (io.Reader, error) {
-	context := context.Background()
-	client, err := storage.NewClient(context, option.WithoutAuthentication())
+func (s *serverType) downloadAndDecompress(ctx context.Context, location *url.URL, compression pb.Compression) (io.ReadCloser, error) {
+	reader, err := s.download(ctx, location, 0)
 	if err != nil {
 		return nil, err
 	}
 
-	bucket := client.Bucket(bucketName)
-
-	remoteFile := bucket.Object(objectPath).ReadCompressed(true)
-	reader, err := remoteFile.NewReader(context)
+	decompressed, err := decompress(reader, compression)
 	if err != nil {
+		reader.Close()
 		return nil, err
 	}
-
-	return reader, err
+	return &decompressedReader{ReadCloser: decompressed, source: reader}, nil
 }
 
-func decompress(reader io.Reader) (io.Reader, error) {
-	newReader, err := gzip.NewReader(reader)
+func (s *serverType) download(ctx context.Context, location *url.URL, offset int64) (io.ReadCloser, error) {
+	source, err := resolveSource(s.sources, location)
 	if err != nil {
 		return nil, err
 	}
-	return newReader, nil
+	reader, err := source.open(ctx, location, offset)
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return &storageReader{ctx: ctx, ReadCloser: reader}, nil
 }
 
-func timeTrack(start time.Time, name string) {
-	elapsed := time.Since(start)
-	log.Infof("%s took %s", name, elapsed)
+// decompressedReader closes the underlying object once reading is done.
+type decompressedReader struct {
+	io.ReadCloser
+	source io.Closer
 }
 
-// for testing purposes
-func loadFromLocalFS(objectPath string) (io.Reader, error) {
-	const folder = "/Downloads/kubernetes-jenkins-310"
-	idx := strings.LastIndex(objectPath, "/") + 1
-	fileName := strings.TrimSuffix(objectPath[idx:], ".gz")
-	home, _ := os.UserHomeDir()
-	return os.Open(filepath.Join(home, folder, fileName))
+func (r *decompressedReader) Close() error {
+	r.ReadCloser.Close()
+	return r.source.Close()
 }
@@ -0,0 +1,329 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	ts "github.com/golang/protobuf/ptypes/timestamp"
+	pb "github.com/kzmrv/gcsreader/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDoWorkFromGCS(t *testing.T) {
+	gcs := newFakeGCS()
+	defer gcs.Close()
+	gcs.objects[defaultBucket+"/logs/audit.log.gz"] = gzipped(t, line2+"\n"+line3+"\n")
+	s := newTestServer(gcs.client(t))
+
+	stream := &fakeWorkStream{ctx: context.Background()}
+	err := s.DoWork(&pb.Work{
+		File:            "logs/audit.log.gz",
+		TargetSubstring: "leases",
+		Since:           &ts.Timestamp{Seconds: 1546441200},
+		Until:           &ts.Timestamp{Seconds: 1546441300},
+	}, stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := stream.lines(); len(lines) != 1 {
+		t.Fatalf("Expected 1 line, got %v", len(lines))
+	}
+}
+
+func TestDoWorkMultipleFiles(t *testing.T) {
+	gcs := newFakeGCS()
+	defer gcs.Close()
+	gcs.objects["scale-tests/logs/master-a/audit.log.gz"] = gzipped(t, line1+"\n")
+	gcs.objects["scale-tests/logs/master-b/audit.log.gz"] = gzipped(t, line2+"\n")
+	s := newTestServer(gcs.client(t))
+	s.allowlist.buckets["scale-tests"] = true
+
+	stream := &fakeWorkStream{ctx: context.Background()}
+	err := s.DoWork(&pb.Work{
+		Bucket: "scale-tests",
+		Files:  []string{"logs/*/audit.log.gz"},
+		Since:  &ts.Timestamp{Seconds: 1546441200},
+		Until:  &ts.Timestamp{Seconds: 1546441300},
+	}, stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := stream.lines()
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %v", len(lines))
+	}
+	if lines[0].Source != "gs://scale-tests/logs/master-a/audit.log.gz" || lines[1].Source != "gs://scale-tests/logs/master-b/audit.log.gz" {
+		t.Fatalf("Unexpected sources %s, %s", lines[0].Source, lines[1].Source)
+	}
+}
+
+func TestListFiles(t *testing.T) {
+	gcs := newFakeGCS()
+	defer gcs.Close()
+	gcs.objects[defaultBucket+"/logs/310/artifacts/master/kube-apiserver-audit.log.gz"] = gzipped(t, line1)
+	gcs.objects[defaultBucket+"/logs/310/artifacts/master/kube-apiserver.log.gz"] = gzipped(t, line2)
+	gcs.objects[defaultBucket+"/logs/311/artifacts/master/kube-apiserver-audit.log.gz"] = gzipped(t, line3)
+	s := newTestServer(gcs.client(t))
+
+	result, err := s.ListFiles(context.Background(), &pb.ListFilesRequest{Prefix: "logs/310/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Files) != 2 {
+		t.Fatalf("Expected 2 files, got %v", result.Files)
+	}
+
+	result, err = s.ListFiles(context.Background(), &pb.ListFilesRequest{Prefix: "logs/", Glob: "*/artifacts/*/kube-apiserver-audit.log*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Files) != 2 {
+		t.Fatalf("Expected 2 files, got %v", result.Files)
+	}
+	file := result.Files[0]
+	if file.Name != "logs/310/artifacts/master/kube-apiserver-audit.log.gz" {
+		t.Fatalf("Unexpected name %s", file.Name)
+	}
+	if file.Size != int64(len(gzipped(t, line1))) || file.Generation != 1546441276105964 || file.ContentEncoding != "gzip" {
+		t.Fatalf("Unexpected attributes %v", file)
+	}
+	if file.Updated.GetSeconds() != 1546441276 {
+		t.Fatalf("Unexpected updated time %v", file.Updated)
+	}
+
+	if _, err := s.ListFiles(context.Background(), &pb.ListFilesRequest{Bucket: "private", Prefix: "logs/"}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("Expected PermissionDenied, got %v", err)
+	}
+}
+
+func TestDoWorkPermissionDenied(t *testing.T) {
+	gcs := newFakeGCS()
+	defer gcs.Close()
+	gcs.forbidden["private"] = true
+	s := newTestServer(gcs.client(t))
+	s.allowlist.buckets["private"] = true
+
+	err := s.DoWork(&pb.Work{Bucket: "private", File: "logs/audit.log.gz"}, &fakeWorkStream{ctx: context.Background()})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("Expected PermissionDenied, got %v", err)
+	}
+
+	err = s.DoWork(&pb.Work{Bucket: "other", File: "logs/audit.log.gz"}, &fakeWorkStream{ctx: context.Background()})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("Expected PermissionDenied for bucket outside allowlist, got %v", err)
+	}
+}
+
+func TestDoWorkReportsMalformedLines(t *testing.T) {
+	path := writeTempFile(t, "audit.log", []byte("not json\n"+line2+"\n"+line3[:100]))
+	defer os.RemoveAll(filepath.Dir(path))
+
+	for _, policy := range []pb.ErrorPolicy{pb.ErrorPolicy_ERROR_POLICY_SKIP, pb.ErrorPolicy_ERROR_POLICY_REPORT} {
+		stream := &fakeWorkStream{ctx: context.Background()}
+		err := newTestServer(nil).DoWork(&pb.Work{File: "file://" + path, ErrorPolicy: policy}, stream)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines := stream.lines(); len(lines) != 1 {
+			t.Fatalf("%v: expected 1 line, got %v", policy, len(lines))
+		}
+		summary := stream.results[len(stream.results)-1].Summary
+		if summary.GetMalformedLines() != 2 || summary.GetTruncatedLines() != 1 || summary.GetSkippedLines() != 2 {
+			t.Fatalf("%v: unexpected summary %v", policy, summary)
+		}
+
+		var samples []*pb.MalformedLine
+		for _, result := range stream.results {
+			samples = append(samples, result.MalformedLines...)
+		}
+		if policy == pb.ErrorPolicy_ERROR_POLICY_SKIP && len(samples) != 0 {
+			t.Fatalf("Expected no samples when skipping, got %v", samples)
+		}
+		if policy == pb.ErrorPolicy_ERROR_POLICY_REPORT && (len(samples) != 2 || samples[0].Line != "not json\n" || !samples[1].Truncated) {
+			t.Fatalf("Unexpected samples %v", samples)
+		}
+	}
+}
+
+func TestDoWorkSummary(t *testing.T) {
+	path := writeTempFile(t, "audit.log", []byte(line1+"\n"+line2+"\n"+line3+"\n"))
+	defer os.RemoveAll(filepath.Dir(path))
+
+	stream := &fakeWorkStream{ctx: context.Background()}
+	err := newTestServer(nil).DoWork(&pb.Work{File: "file://" + path, TargetSubstring: "patch"}, stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary := stream.results[len(stream.results)-1].Summary
+	expectedBytes := int64(len(line1) + len(line2) + len(line3) + 3)
+	if summary.GetBytesRead() != expectedBytes || summary.GetLinesScanned() != 3 || summary.GetLinesMatched() != 1 || summary.GetCode() != 0 {
+		t.Fatalf("Unexpected summary %v", summary)
+	}
+}
+
+func TestDoWorkErrorCodes(t *testing.T) {
+	corrupt := gzipped(t, line1+"\n"+line2+"\n")
+	path := writeTempFile(t, "audit.log.gz", corrupt[:len(corrupt)-4])
+	defer os.RemoveAll(filepath.Dir(path))
+
+	for _, test := range []struct {
+		work     *pb.Work
+		expected codes.Code
+	}{
+		{&pb.Work{File: "file://" + path + ".missing"}, codes.NotFound},
+		{&pb.Work{File: "file://" + path, TargetSubstring: "("}, codes.InvalidArgument},
+		{&pb.Work{File: "file://" + path}, codes.DataLoss},
+	} {
+		stream := &fakeWorkStream{ctx: context.Background()}
+		err := newTestServer(nil).DoWork(test.work, stream)
+		if status.Code(err) != test.expected {
+			t.Fatalf("Expected %v, got %v", test.expected, err)
+		}
+	}
+
+	// Lines read before the corruption are still sent, and the summary
+	// tells the client the result is incomplete.
+	stream := &fakeWorkStream{ctx: context.Background()}
+	newTestServer(nil).DoWork(&pb.Work{File: "file://" + path}, stream)
+	summary := stream.results[len(stream.results)-1].Summary
+	if summary.GetCode() != int32(codes.DataLoss) || summary.GetError() == "" {
+		t.Fatalf("Unexpected summary %v", summary)
+	}
+}
+
+func TestDoWorkSendError(t *testing.T) {
+	path := writeTempFile(t, "audit.log", []byte(line1+"\n"))
+	defer os.RemoveAll(filepath.Dir(path))
+
+	stream := &fakeWorkStream{ctx: context.Background(), sendErr: status.Error(codes.Canceled, "client went away")}
+	err := newTestServer(nil).DoWork(&pb.Work{File: "file://" + path}, stream)
+	if status.Code(err) != codes.Canceled {
+		t.Fatalf("Expected Canceled, got %v", err)
+	}
+}
+
+func TestDoWorkStopsReading(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		timeout  time.Duration
+		sendErr  error
+		expected codes.Code
+	}{
+		{"deadline", 50 * time.Millisecond, nil, codes.DeadlineExceeded},
+		// The stream context stays alive, only the failed send stops reading.
+		{"send failure", time.Hour, status.Error(codes.Unavailable, "transport is closing"), codes.Unavailable},
+	} {
+		before := runtime.NumGoroutine()
+		source := &slowSource{closed: make(chan struct{})}
+		s := newTestServer(nil)
+		s.sources["slow"] = source
+
+		ctx, cancel := context.WithTimeout(context.Background(), test.timeout)
+		defer cancel()
+		stream := &fakeWorkStream{ctx: ctx, sendErr: test.sendErr}
+		err := s.DoWork(&pb.Work{File: "slow://logs/audit.log"}, stream)
+		if status.Code(err) != test.expected {
+			t.Fatalf("%s: expected %v, got %v", test.name, test.expected, err)
+		}
+
+		select {
+		case <-source.closed:
+		case <-time.After(time.Second):
+			t.Fatalf("%s: expected the object to be closed", test.name)
+		}
+		for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > before; time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: %v goroutines leaked", test.name, runtime.NumGoroutine()-before)
+			}
+		}
+	}
+}
+
+// slowSource serves an endless object a line at a time and, like network
+// sources, stops once the request context is done.
+type slowSource struct {
+	closed chan struct{}
+}
+
+func (s *slowSource) open(ctx context.Context, _ *url.URL, _ int64) (io.ReadCloser, error) {
+	return &slowReader{ctx: ctx, closed: s.closed}, nil
+}
+
+func (*slowSource) stat(context.Context, *url.URL) (*objectInfo, error) {
+	return nil, status.Error(codes.Unimplemented, "stat is not supported")
+}
+
+func (*slowSource) list(context.Context, *url.URL) ([]*objectInfo, error) {
+	return nil, status.Error(codes.Unimplemented, "listing is not supported")
+}
+
+type slowReader struct {
+	ctx    context.Context
+	closed chan struct{}
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	select {
+	case <-r.ctx.Done():
+		return 0, r.ctx.Err()
+	case <-time.After(time.Millisecond):
+		return copy(p, line2+"\n"), nil
+	}
+}
+
+func (r *slowReader) Close() error {
+	close(r.closed)
+	return nil
+}
+
+// fakeWorkStream collects results sent by DoWork.
+type fakeWorkStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	results []*pb.WorkResult
+	sendErr error
+}
+
+func (f *fakeWorkStream) Context() context.Context {
+	return f.ctx
+}
+
+func (f *fakeWorkStream) Send(result *pb.WorkResult) error {
+	if f.sendErr != nil {
+		return f.sendErr
+	}
+	f.results = append(f.results, result)
+	return nil
+}
+
+func (f *fakeWorkStream) lines() []*pb.LogLine {
+	var lines []*pb.LogLine
+	for _, result := range f.results {
+		lines = append(lines, result.LogLines...)
+	}
+	return lines
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"container/heap"
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	pb "github.com/kzmrv/gcsreader/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultReorderWindow = 10 * time.Second
+	maxReorderWindow     = time.Hour
+)
+
+// reorderWindow validates an ordered request and returns how far lines
+// may be out of order within an object.
+func reorderWindow(request *pb.Work) (time.Duration, error) {
+	if request.Cursor != nil {
+		return 0, status.Error(codes.InvalidArgument, "ordered results cannot be resumed from a cursor")
+	}
+	if request.ReorderWindow == nil {
+		return defaultReorderWindow, nil
+	}
+	window, err := ptypes.Duration(request.ReorderWindow)
+	if err != nil || window < 0 || window > maxReorderWindow {
+		return 0, status.Errorf(codes.InvalidArgument, "reorder window must be between 0 and %v", maxReorderWindow)
+	}
+	return window, nil
+}
+
+// readObjectsOrdered reads all objects at once and merges their lines
+// into ch by time. Lines of an object are held back until a line more
+// than window later was read from it, so earlier lines arriving within
+// the window are still put in place. Other entries are passed on as they
+// come, and the first error stops reading.
+func (s *serverType) readObjectsOrdered(ctx context.Context, locations []*url.URL, compression pb.Compression, ch chan *lineEntry, filters *lineFilter, window time.Duration) {
+	defer close(ch)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	streams := make([]*orderedStream, len(locations))
+	for i, location := range locations {
+		stream := &orderedStream{index: i, ch: make(chan *lineEntry, s.orderedBuffer), window: window}
+		streams[i] = stream
+		go func(location *url.URL) {
+			defer close(stream.ch)
+			if err := s.readObject(ctx, location, compression, stream.ch, filters); err != nil {
+				sendLine(ctx, stream.ch, &lineEntry{err: err})
+			}
+		}(location)
+	}
+
+	heads := &streamHeap{}
+	for _, stream := range streams {
+		if !stream.advance(ctx, ch) {
+			return
+		}
+		if stream.head != nil {
+			heads.streams = append(heads.streams, stream)
+		}
+	}
+	heap.Init(heads)
+
+	var latest time.Time
+	for len(heads.streams) > 0 {
+		stream := heads.streams[0]
+		entry := stream.head
+		if entry.logEntry.time.Before(latest) {
+			entry.logEntry.late = true
+		} else {
+			latest = *entry.logEntry.time
+		}
+		if sendLine(ctx, ch, entry) != nil || !stream.advance(ctx, ch) {
+			return
+		}
+		if stream.head != nil {
+			heap.Fix(heads, 0)
+		} else {
+			heap.Pop(heads)
+		}
+	}
+}
+
+// orderedStream reorders the lines of a single object within its window.
+type orderedStream struct {
+	index  int
+	ch     chan *lineEntry
+	window time.Duration
+	// head is the next line of the object in time order, nil at its end.
+	head *lineEntry
+
+	pending lineHeap
+	newest  time.Time
+	closed  bool
+}
+
+// advance reads the object until its next line in time order is known and
+// forwards other entries to out. It returns false when reading stopped
+// with an error, which is forwarded too.
+func (s *orderedStream) advance(ctx context.Context, out chan *lineEntry) bool {
+	for {
+		if len(s.pending.entries) > 0 && (s.closed || !s.pending.entries[0].logEntry.time.After(s.newest.Add(-s.window))) {
+			s.head = heap.Pop(&s.pending).(*lineEntry)
+			return true
+		}
+		if s.closed {
+			s.head = nil
+			return true
+		}
+		entry, ok := <-s.ch
+		switch {
+		case !ok:
+			s.closed = true
+		case entry.logEntry != nil:
+			s.pending.sequence++
+			heap.Push(&s.pending, entry)
+			if entry.logEntry.time.After(s.newest) {
+				s.newest = *entry.logEntry.time
+			}
+		default:
+			if sendLine(ctx, out, entry) != nil || entry.err != nil {
+				return false
+			}
+		}
+	}
+}
+
+// lineHeap orders lines by time, and lines of the same time by arrival.
+type lineHeap struct {
+	entries   []*lineEntry
+	sequences []int64
+	sequence  int64
+}
+
+func (h *lineHeap) Len() int { return len(h.entries) }
+
+func (h *lineHeap) Less(i, j int) bool {
+	ti, tj := *h.entries[i].logEntry.time, *h.entries[j].logEntry.time
+	if !ti.Equal(tj) {
+		return ti.Before(tj)
+	}
+	return h.sequences[i] < h.sequences[j]
+}
+
+func (h *lineHeap) Swap(i, j int) {
+	h.entries[i], h.entries[j] = h.entries[j], h.entries[i]
+	h.sequences[i], h.sequences[j] = h.sequences[j], h.sequences[i]
+}
+
+func (h *lineHeap) Push(x interface{}) {
+	h.entries = append(h.entries, x.(*lineEntry))
+	h.sequences = append(h.sequences, h.sequence)
+}
+
+func (h *lineHeap) Pop() interface{} {
+	last := len(h.entries) - 1
+	entry := h.entries[last]
+	h.entries, h.sequences = h.entries[:last], h.sequences[:last]
+	return entry
+}
+
+// streamHeap orders objects by their next line, and objects with lines of
+// the same time by request order.
+type streamHeap struct {
+	streams []*orderedStream
+}
+
+func (h *streamHeap) Len() int { return len(h.streams) }
+
+func (h *streamHeap) Less(i, j int) bool {
+	ti, tj := *h.streams[i].head.logEntry.time, *h.streams[j].head.logEntry.time
+	if !ti.Equal(tj) {
+		return ti.Before(tj)
+	}
+	return h.streams[i].index < h.streams[j].index
+}
+
+func (h *streamHeap) Swap(i, j int) { h.streams[i], h.streams[j] = h.streams[j], h.streams[i] }
+
+func (h *streamHeap) Push(x interface{}) { h.streams = append(h.streams, x.(*orderedStream)) }
+
+func (h *streamHeap) Pop() interface{} {
+	last := len(h.streams) - 1
+	stream := h.streams[last]
+	h.streams = h.streams[:last]
+	return stream
+}
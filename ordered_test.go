@@ -0,0 +1,126 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/duration"
+	pb "github.com/kzmrv/gcsreader/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// eventsAt returns audit lines received at the given offsets in seconds
+// from auditLogStart, with the offsets as audit IDs.
+func eventsAt(offsets ...float64) string {
+	var lines strings.Builder
+	for _, offset := range offsets {
+		received := auditLogStart.Add(time.Duration(offset * float64(time.Second)))
+		fmt.Fprintf(&lines, `{"kind":"Event","apiVersion":"audit.k8s.io/v1","auditID":"%v","stage":"ResponseComplete","verb":"get","requestReceivedTimestamp":"%s","stageTimestamp":"%s"}`+"\n",
+			offset, received.Format(time.RFC3339Nano), received.Format(time.RFC3339Nano))
+	}
+	return lines.String()
+}
+
+func TestDoWorkOrdered(t *testing.T) {
+	dir := filepath.Dir(writeTempFile(t, "a.log", []byte(eventsAt(1, 3, 2, 6, 8))))
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "b.log.gz"), gzipped(t, eventsAt(0, 4, 5, 7, 9)+"not json\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "c.log"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name     string
+		window   *duration.Duration
+		expected []string
+		late     int64
+	}{
+		{"default window", nil, []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"}, 0},
+		{"no window", &duration.Duration{}, []string{"0", "1", "3", "2", "4", "5", "6", "7", "8", "9"}, 1},
+	} {
+		stream := &fakeWorkStream{ctx: context.Background()}
+		err := newTestServer(nil).DoWork(&pb.Work{
+			Files:         []string{"file://" + dir + "/"},
+			Ordered:       true,
+			ReorderWindow: test.window,
+			Projection:    []string{"auditID"},
+		}, stream)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, line := range stream.lines() {
+			ids = append(ids, strings.TrimSuffix(strings.TrimPrefix(line.Projection, `{"auditID":"`), `"}`))
+		}
+		if strings.Join(ids, ",") != strings.Join(test.expected, ",") {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, ids)
+		}
+		for _, result := range stream.results {
+			if result.Cursor != nil {
+				t.Errorf("%s: expected no cursors, got %v", test.name, result.Cursor)
+			}
+		}
+		summary := stream.results[len(stream.results)-1].Summary
+		if summary.LateLines != test.late || summary.MalformedLines != 1 || summary.LinesScanned != 11 {
+			t.Errorf("%s: unexpected summary %v", test.name, summary)
+		}
+	}
+}
+
+func TestDoWorkOrderedErrors(t *testing.T) {
+	path := writeTempFile(t, "a.log", []byte(eventsAt(1, 2)+"not json\n"+eventsAt(3)))
+	defer os.RemoveAll(filepath.Dir(path))
+	stream := &fakeWorkStream{ctx: context.Background()}
+	err := newTestServer(nil).DoWork(&pb.Work{
+		Files:       []string{"file://" + path, "file://" + path + ".missing"},
+		Ordered:     true,
+		ErrorPolicy: pb.ErrorPolicy_ERROR_POLICY_STOP,
+	}, stream)
+	if code := status.Code(err); code != codes.DataLoss && code != codes.NotFound {
+		t.Fatalf("Expected the error of either file, got %v", err)
+	}
+
+	for _, request := range []*pb.Work{
+		{File: "file://" + path, Ordered: true, Cursor: &pb.Cursor{Source: "file://" + path}},
+		{File: "file://" + path, Ordered: true, ReorderWindow: &duration.Duration{Seconds: -1}},
+		{File: "file://" + path, Ordered: true, ReorderWindow: &duration.Duration{Seconds: 86400}},
+	} {
+		err := newTestServer(nil).DoWork(request, &fakeWorkStream{ctx: context.Background()})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument for %v, got %v", request, err)
+		}
+	}
+
+	// Objects are all read at once, so their number is bounded.
+	s := newTestServer(nil)
+	s.maxOrderedObjects = 1
+	err = s.DoWork(&pb.Work{Files: []string{"file://" + path, "file://" + path + ".gz"}, Ordered: true}, &fakeWorkStream{ctx: context.Background()})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for too many ordered objects, got %v", err)
+	}
+}
@@ -18,71 +18,201 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
 	"io"
 	"strings"
 	"time"
 
+	pb "github.com/kzmrv/gcsreader/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"k8s.io/klog"
 )
 
-func getMatchingLines(reader io.Reader, ch chan *lineEntry, filters *lineFilter) {
-	defer close(ch)
+// getMatchingLines sends lines of reader passing filters to ch, tagged
+// with source, followed by how much was scanned. Lines that cannot be
+// parsed are sent as malformed, or end reading with an error under
+// ERROR_POLICY_STOP. It returns nil once the whole reader has been
+// consumed.
+func getMatchingLines(ctx context.Context, reader io.Reader, ch chan *lineEntry, filters *lineFilter, source string) error {
+	return getMatchingLinesFrom(ctx, reader, ch, filters, source, linePosition{})
+}
+
+// getMatchingLinesFrom is getMatchingLines for a reader starting at start
+// of the source rather than at its beginning.
+func getMatchingLinesFrom(ctx context.Context, reader io.Reader, ch chan *lineEntry, filters *lineFilter, source string, start linePosition) error {
+	scanned := &scanProgress{}
+	defer sendLine(ctx, ch, &lineEntry{scanned: scanned})
+
 	r := bufio.NewReader(reader)
+	position := start
 	for {
-		line, err := r.ReadBytes('\n')
-		if err != nil {
-			ch <- &lineEntry{err: err}
-			return
+		if err := ctx.Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+		line, readErr := r.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return readErr
 		}
-		if !filters.regex.Match(line) {
-			continue
+		position.offset += int64(len(line))
+		position.lineNumber++
+		if len(line) != 0 && filters.regex.Match(line) {
+			entry, err := parseLine(string(line))
+			if err != nil {
+				malformed := &malformedLine{
+					source:    source,
+					position:  position,
+					line:      string(line),
+					err:       err,
+					truncated: readErr == io.EOF,
+				}
+				if filters.errorPolicy == pb.ErrorPolicy_ERROR_POLICY_STOP {
+					return status.Error(codes.DataLoss, malformed.Error())
+				}
+				klog.V(2).Info(malformed)
+				if err := sendLine(ctx, ch, &lineEntry{malformed: malformed}); err != nil {
+					return err
+				}
+			} else {
+				// Sampling depends on where the line is, so that is set first.
+				entry.source = source
+				entry.position = position
+				if filters.matches(entry) {
+					if err := sendLine(ctx, ch, &lineEntry{logEntry: entry}); err != nil {
+						return err
+					}
+				}
+			}
 		}
-		entry, err := parseLine(string(line))
-		if err != nil {
-			// TODO There is a problem that files finish with incomplete line
-			klog.Errorf("%s error parsing line %s", err, line)
-			return
+		// Only lines handled completely count, so the scanned position
+		// never runs ahead of what was sent.
+		scanned.bytes += int64(len(line))
+		if len(line) != 0 {
+			scanned.lines++
 		}
-		if (filters.since.IsZero() || filters.since.Before(*entry.time)) &&
-			(filters.until.IsZero() || filters.until.After(*entry.time)) {
-			ch <- &lineEntry{logEntry: entry}
+		if readErr == io.EOF {
+			return nil
 		}
 	}
 }
 
+// sendLine delivers entry to ch unless ctx is done first.
+func sendLine(ctx context.Context, ch chan<- *lineEntry, entry *lineEntry) error {
+	select {
+	case ch <- entry:
+		return nil
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// matches checks entry against the time window and event predicates. The
+// window applies to the selected timestamp, which replaces the entry time.
+func (f *lineFilter) matches(entry *logEntry) bool {
+	if f.timestamp != nil {
+		if timestamp, ok := f.timestamp(entry); ok {
+			entry.time = &timestamp
+		}
+	}
+	return (f.since.IsZero() || f.since.Before(*entry.time)) &&
+		(f.until.IsZero() || f.until.After(*entry.time)) &&
+		(f.event == nil || f.event(entry.event)) &&
+		(f.sample == nil || f.sample(entry))
+}
+
 func parseLine(line string) (*logEntry, error) {
-	const startMarker = "ReceivedTimestamp\":\""
-	const endMarker = "\",\"stageTimestamp"
-	start := strings.Index(line, startMarker)
-	end := strings.Index(line, endMarker)
-	if start == -1 {
-		return &logEntry{}, &parseLineFailedError{line}
+	event := &auditEvent{}
+	// Decoding only the first JSON value tolerates whatever line
+	// terminator follows it.
+	if err := json.NewDecoder(strings.NewReader(line)).Decode(event); err != nil {
+		return &logEntry{}, &parseLineFailedError{line, err.Error()}
 	}
-	if end == -1 {
-		return &logEntry{}, &parseLineFailedError{line}
+	if event.Kind != "Event" || (event.APIVersion != auditAPIVersionV1 && event.APIVersion != auditAPIVersionV1beta1) {
+		return &logEntry{}, &parseLineFailedError{line, "not an audit event"}
 	}
-	timestamp := line[(start + len(startMarker)):end]
-	parsed, e := time.Parse(time.RFC3339Nano, timestamp)
-	if e != nil {
-		return nil, e
+	received := event.receivedTimestamp()
+	if received.IsZero() {
+		return &logEntry{}, &parseLineFailedError{line, "no request received timestamp"}
 	}
-	return &logEntry{log: &line, time: &parsed}, nil
+	return &logEntry{log: &line, time: &received, event: event}, nil
 }
 
 func (e *parseLineFailedError) Error() string {
-	return "Failed to parse line: " + e.line
+	return "Failed to parse line: " + e.reason
 }
 
 type parseLineFailedError struct {
-	line string
+	line   string
+	reason string
 }
 
+// lineEntry carries exactly one of its fields from the reading goroutine.
 type lineEntry struct {
-	logEntry *logEntry
-	err      error
+	logEntry  *logEntry
+	malformed *malformedLine
+	scanned   *scanProgress
+	err       error
+}
+
+// scanProgress counts what was read of a source, matching or not. It is
+// sent once the source is done.
+type scanProgress struct {
+	bytes int64
+	lines int64
 }
 
 type logEntry struct {
-	log  *string
-	time *time.Time
+	log      *string
+	time     *time.Time
+	event    *auditEvent
+	source   string
+	position linePosition
+	// late is set on ordered results returned after later lines.
+	late bool
+	// duplicate is set on lines left out for another line of their
+	// auditID, which carries stages when they are combined.
+	duplicate bool
+	stages    *requestStages
+}
+
+// linePosition is the point just past a line in the uncompressed content
+// of a source.
+type linePosition struct {
+	offset int64
+	// lineNumber is 1-based, so the start of a source is line 0.
+	lineNumber int64
+}
+
+// malformedLine is a line matching the regex that is not an audit event.
+type malformedLine struct {
+	source   string
+	position linePosition
+	line     string
+	err      error
+	// truncated is set for an unterminated last line, usually a log file
+	// still being written.
+	truncated bool
+}
+
+func (m *malformedLine) Error() string {
+	return fmt.Sprintf("malformed line %d of %s: %v", m.position.lineNumber, m.source, m.err)
+}
+
+// maxMalformedSampleSize limits how much of a malformed line is reported.
+const maxMalformedSampleSize = 1024
+
+func (m *malformedLine) proto() *pb.MalformedLine {
+	line := m.line
+	if len(line) > maxMalformedSampleSize {
+		line = line[:maxMalformedSampleSize]
+	}
+	return &pb.MalformedLine{
+		Source:     m.source,
+		LineNumber: m.position.lineNumber,
+		Line:       line,
+		Error:      m.err.Error(),
+		Truncated:  m.truncated,
+	}
 }
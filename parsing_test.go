@@ -17,11 +17,16 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"io"
 	"regexp"
 	"strings"
 	"testing"
 	"time"
+
+	pb "github.com/kzmrv/gcsreader/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestMatchSingleLine(t *testing.T) {
@@ -54,16 +59,154 @@ func TestParseSingleLine(t *testing.T) {
 	}
 }
 
+func TestParseAuditEventFields(t *testing.T) {
+	line, err := parseLine(line3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := line.event
+	if event.AuditID != "39aec93e-031b-4002-8c0a-4ddcd92e250b" || event.Stage != "ResponseComplete" || event.Verb != "patch" {
+		t.Fatalf("Unexpected event %+v", event)
+	}
+	if event.User.Username != "system:node-problem-detector" || len(event.User.Groups) != 1 {
+		t.Fatalf("Unexpected user %+v", event.User)
+	}
+	if event.ObjectRef.Resource != "nodes" || event.ObjectRef.Subresource != "status" || event.ObjectRef.Name != "gce-scale-cluster-minion-group-2-t86q" {
+		t.Fatalf("Unexpected objectRef %+v", event.ObjectRef)
+	}
+	if event.ResponseStatus.Code != 200 {
+		t.Fatalf("Unexpected response code %v", event.ResponseStatus.Code)
+	}
+	if event.StageTimestamp.UTC() != time.Unix(1546441276, 108460000).UTC() {
+		t.Fatalf("Unexpected stage timestamp %s", event.StageTimestamp)
+	}
+	if event.Annotations["authorization.k8s.io/decision"] != "allow" {
+		t.Fatalf("Unexpected annotations %v", event.Annotations)
+	}
+}
+
+func TestParseLatency(t *testing.T) {
+	line, err := parseLine(line3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latency, ok := line.event.latency(); !ok || latency != 3899*time.Microsecond {
+		t.Fatalf("Unexpected latency %v", latency)
+	}
+	if seconds := auditFields["latency"](line.event); len(seconds) != 1 || seconds[0] != "0.003899" {
+		t.Fatalf("Unexpected latency field %v", seconds)
+	}
+
+	line.event.StageTimestamp = time.Time{}
+	if latency, ok := line.event.latency(); ok {
+		t.Fatalf("Expected no latency without stage timestamp, got %v", latency)
+	}
+}
+
+func TestParseReorderedFields(t *testing.T) {
+	const reordered = `{"stageTimestamp":"2019-01-02T15:01:16.108038Z","kind":"Event","apiVersion":"audit.k8s.io/v1","auditID":"0286b87c","stage":"ResponseComplete","verb":"get","annotations":{"a":"b"},"requestReceivedTimestamp":"2019-01-02T15:01:16.105964Z","user":{"username":"admin"}}`
+	line, err := parseLine(reordered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line.time.UTC() != time.Unix(1546441276, 105964000).UTC() {
+		t.Fatalf("Unexpected time %s", line.time)
+	}
+}
+
+func TestParseV1beta1Event(t *testing.T) {
+	const v1beta1 = `{"kind":"Event","apiVersion":"audit.k8s.io/v1beta1","metadata":{"creationTimestamp":"2019-01-02T15:01:16Z"},"level":"Metadata","timestamp":"2019-01-02T15:01:16Z","auditID":"0286b87c","stage":"ResponseComplete","verb":"get","user":{"username":"admin"}}`
+	line, err := parseLine(v1beta1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line.time.UTC() != time.Unix(1546441276, 0).UTC() {
+		t.Fatalf("Unexpected time %s", line.time)
+	}
+}
+
+func TestParseNonAuditLine(t *testing.T) {
+	for _, line := range []string{
+		`{"kind":"Pod","apiVersion":"v1"}`,
+		`{"kind":"Event","apiVersion":"audit.k8s.io/v1","auditID":"0286b87c"}`,
+		`{"kind":"Event","apiVersion":"audit.k8s.io/v1","requestReceivedTimestamp":"2019-01-02T15:0`,
+	} {
+		if _, err := parseLine(line); err == nil {
+			t.Errorf("Expected error parsing %s", line)
+		}
+	}
+}
+
+func TestMalformedLines(t *testing.T) {
+	text := line1 + "\nnot json\n" + line2 + "\n" + line3[:100]
+	ch := make(chan *lineEntry, 100)
+	if err := getMatchingLines(context.Background(), strings.NewReader(text), ch, &lineFilter{regex: regexp.MustCompile("")}, "audit.log"); err != nil {
+		t.Fatal(err)
+	}
+	close(ch)
+
+	var parsed int
+	var malformed []*malformedLine
+	for line := range ch {
+		if line.malformed != nil {
+			malformed = append(malformed, line.malformed)
+		}
+		if line.logEntry != nil {
+			parsed++
+		}
+	}
+	if parsed != 2 || len(malformed) != 2 {
+		t.Fatalf("Expected 2 parsed and 2 malformed lines, got %v and %v", parsed, len(malformed))
+	}
+	if malformed[0].position.lineNumber != 2 || malformed[0].truncated {
+		t.Errorf("Unexpected malformed line %+v", malformed[0])
+	}
+	if malformed[1].position.lineNumber != 4 || !malformed[1].truncated || malformed[1].source != "audit.log" {
+		t.Errorf("Unexpected truncated line %+v", malformed[1])
+	}
+}
+
+func TestMalformedLineStops(t *testing.T) {
+	text := line1 + "\nnot json\n" + line2 + "\n"
+	ch := make(chan *lineEntry, 100)
+	err := getMatchingLines(context.Background(), strings.NewReader(text), ch, &lineFilter{
+		regex:       regexp.MustCompile(""),
+		errorPolicy: pb.ErrorPolicy_ERROR_POLICY_STOP,
+	}, "audit.log")
+	if status.Code(err) != codes.DataLoss {
+		t.Fatalf("Expected DataLoss, got %v", err)
+	}
+	close(ch)
+	var parsed int
+	for line := range ch {
+		if line.logEntry != nil {
+			parsed++
+		}
+		if line.scanned != nil && line.scanned.lines != 1 {
+			t.Errorf("Expected reading to stop at the malformed line 2, scanned %v", line.scanned.lines)
+		}
+	}
+	if parsed != 1 {
+		t.Fatalf("Expected only the line before the malformed one, got %v", parsed)
+	}
+}
+
 func processAllLines(reader io.Reader, regex *regexp.Regexp) ([]*logEntry, error) {
 	res := make([]*logEntry, 0)
 	ch := make(chan *lineEntry, 100000)
-	go getMatchingLines(reader, ch, &lineFilter{regex: regex})
+	go func() {
+		defer close(ch)
+		getMatchingLines(context.Background(), reader, ch, &lineFilter{regex: regex}, "")
+	}()
 	for {
 		line, hasMore := <-ch
 		if !hasMore {
 			return res, nil
 		}
-		res = append(res, line.logEntry)
+		if line.logEntry != nil {
+			res = append(res, line.logEntry)
+		}
 	}
 }
 
@@ -0,0 +1,117 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// fieldProjection is a list of dot-separated JSON paths to keep from each
+// matching line, e.g. objectRef.resource.
+type fieldProjection [][]string
+
+// parseProjection accepts paths one per entry or comma-separated.
+func parseProjection(fields []string) (fieldProjection, error) {
+	var projection fieldProjection
+	for _, entry := range fields {
+		for _, field := range strings.Split(entry, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			path, err := parseJSONPath(field)
+			if err != nil {
+				return nil, fmt.Errorf("bad projection field: %v", err)
+			}
+			projection = append(projection, path)
+		}
+	}
+	return projection, nil
+}
+
+// apply returns a JSON document with only the projected paths of line,
+// nested as in the original. Missing paths are left out. Only objects on
+// the way to a projected path are decoded, so large request and response
+// bodies are skipped unless asked for.
+func (p fieldProjection) apply(line string) (string, error) {
+	var document map[string]json.RawMessage
+	if err := json.NewDecoder(strings.NewReader(line)).Decode(&document); err != nil {
+		return "", err
+	}
+
+	projected := map[string]interface{}{}
+	for _, path := range p {
+		value, ok := lookupJSONPath(document, path)
+		if !ok {
+			continue
+		}
+		target := projected
+		for _, key := range path[:len(path)-1] {
+			existing, present := target[key]
+			next, isObject := existing.(map[string]interface{})
+			if present && !isObject {
+				// A parent path is projected whole already.
+				target = nil
+				break
+			}
+			if !present {
+				next = map[string]interface{}{}
+				target[key] = next
+			}
+			target = next
+		}
+		if target != nil {
+			target[path[len(path)-1]] = value
+		}
+	}
+
+	result, err := json.Marshal(projected)
+	if err != nil {
+		return "", err
+	}
+	return string(result), nil
+}
+
+// parseJSONPath splits a dot-separated path into its keys.
+func parseJSONPath(field string) ([]string, error) {
+	path := strings.Split(field, ".")
+	for _, key := range path {
+		if key == "" {
+			return nil, fmt.Errorf("empty key in path %q", field)
+		}
+	}
+	return path, nil
+}
+
+// lookupJSONPath follows path through nested objects of document.
+func lookupJSONPath(document map[string]json.RawMessage, path []string) (json.RawMessage, bool) {
+	value, ok := document[path[0]]
+	if !ok {
+		return nil, false
+	}
+	if len(path) == 1 {
+		return value, true
+	}
+	var nested map[string]json.RawMessage
+	if err := json.Unmarshal(value, &nested); err != nil {
+		// Not an object, so the rest of the path cannot exist.
+		return nil, false
+	}
+	return lookupJSONPath(nested, path[1:])
+}
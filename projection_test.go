@@ -0,0 +1,98 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	ts "github.com/golang/protobuf/ptypes/timestamp"
+	pb "github.com/kzmrv/gcsreader/proto"
+)
+
+func TestProjection(t *testing.T) {
+	for _, test := range []struct {
+		fields   []string
+		expected string
+	}{
+		{
+			[]string{"auditID,verb,objectRef.resource,responseStatus.code"},
+			`{"auditID":"39aec93e-031b-4002-8c0a-4ddcd92e250b","objectRef":{"resource":"nodes"},"responseStatus":{"code":200},"verb":"patch"}`,
+		},
+		{
+			[]string{"objectRef.name", "objectRef", "objectRef.resource"},
+			`{"objectRef":{"resource":"nodes","name":"gce-scale-cluster-minion-group-2-t86q","apiVersion":"v1","subresource":"status"}}`,
+		},
+		{
+			[]string{"user.groups", "objectRef.namespace", "verb.nested", "missing"},
+			`{"user":{"groups":["system:authenticated"]}}`,
+		},
+	} {
+		projection, err := parseProjection(test.fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		projected, err := projection.apply(line3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if projected != test.expected {
+			t.Errorf("Expected projection %s, got %s", test.expected, projected)
+		}
+	}
+}
+
+func TestBadProjection(t *testing.T) {
+	if _, err := parseProjection([]string{"verb,objectRef..name"}); err == nil {
+		t.Fatal("Expected error for empty path segment")
+	}
+}
+
+func TestDoWorkWithProjection(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gcsreader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log.gz")
+	if err := ioutil.WriteFile(path, gzipped(t, line2+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stream := &fakeWorkStream{ctx: context.Background()}
+	err = newTestServer(nil).DoWork(&pb.Work{
+		File:       "file://" + path,
+		Projection: []string{"verb"},
+		Since:      &ts.Timestamp{Seconds: 1546441200},
+		Until:      &ts.Timestamp{Seconds: 1546441300},
+	}, stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := stream.lines()
+	if len(lines) != 1 || lines[0].Entry != "" || lines[0].Projection != `{"verb":"update"}` {
+		t.Fatalf("Unexpected lines %v", lines)
+	}
+	if latency, _ := ptypes.Duration(lines[0].Latency); latency != 1761*time.Microsecond {
+		t.Fatalf("Unexpected latency %v", lines[0].Latency)
+	}
+}
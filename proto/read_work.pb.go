@@ -9,6 +9,7 @@ import (
 	math "math"
 
 	proto "github.com/golang/protobuf/proto"
+	duration "github.com/golang/protobuf/ptypes/duration"
 	timestamp "github.com/golang/protobuf/ptypes/timestamp"
 	grpc "google.golang.org/grpc"
 	codes "google.golang.org/grpc/codes"
@@ -26,182 +27,1877 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 
+type Deduplication int32
+
+const (
+	Deduplication_DEDUPLICATION_NONE Deduplication = 0
+	// Return only the line of the latest stage of each request.
+	Deduplication_DEDUPLICATION_LATEST_STAGE Deduplication = 1
+	// Like latest stage, with the timestamps of all stages read in
+	// LogLine.stages.
+	Deduplication_DEDUPLICATION_COMBINED Deduplication = 2
+)
+
+var Deduplication_name = map[int32]string{
+	0: "DEDUPLICATION_NONE",
+	1: "DEDUPLICATION_LATEST_STAGE",
+	2: "DEDUPLICATION_COMBINED",
+}
+
+var Deduplication_value = map[string]int32{
+	"DEDUPLICATION_NONE":         0,
+	"DEDUPLICATION_LATEST_STAGE": 1,
+	"DEDUPLICATION_COMBINED":     2,
+}
+
+func (x Deduplication) String() string {
+	return proto.EnumName(Deduplication_name, int32(x))
+}
+
+func (Deduplication) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_5da7706f7097cf70, []int{0}
+}
+
+type SamplingMode int32
+
+const (
+	// Each line is kept with the given rate by a hash of seed, its file and
+	// line number, so the same request returns the same sample, also when
+	// resumed from a cursor.
+	SamplingMode_SAMPLING_RANDOM SamplingMode = 0
+	// Lines are kept by a hash of their auditID and seed, so all stages of
+	// a sampled request are kept, across files and requests.
+	SamplingMode_SAMPLING_AUDIT_ID SamplingMode = 1
+)
+
+var SamplingMode_name = map[int32]string{
+	0: "SAMPLING_RANDOM",
+	1: "SAMPLING_AUDIT_ID",
+}
+
+var SamplingMode_value = map[string]int32{
+	"SAMPLING_RANDOM":   0,
+	"SAMPLING_AUDIT_ID": 1,
+}
+
+func (x SamplingMode) String() string {
+	return proto.EnumName(SamplingMode_name, int32(x))
+}
+
+func (SamplingMode) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_5da7706f7097cf70, []int{1}
+}
+
+type ErrorPolicy int32
+
+const (
+	// Count malformed lines in the summary and keep going.
+	ErrorPolicy_ERROR_POLICY_SKIP ErrorPolicy = 0
+	// Fail the request at the first malformed line.
+	ErrorPolicy_ERROR_POLICY_STOP ErrorPolicy = 1
+	// Like skip, but also stream samples of the malformed lines.
+	ErrorPolicy_ERROR_POLICY_REPORT ErrorPolicy = 2
+)
+
+var ErrorPolicy_name = map[int32]string{
+	0: "ERROR_POLICY_SKIP",
+	1: "ERROR_POLICY_STOP",
+	2: "ERROR_POLICY_REPORT",
+}
+
+var ErrorPolicy_value = map[string]int32{
+	"ERROR_POLICY_SKIP":   0,
+	"ERROR_POLICY_STOP":   1,
+	"ERROR_POLICY_REPORT": 2,
+}
+
+func (x ErrorPolicy) String() string {
+	return proto.EnumName(ErrorPolicy_name, int32(x))
+}
+
+func (ErrorPolicy) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_5da7706f7097cf70, []int{2}
+}
+
+type TimestampField int32
+
+const (
+	TimestampField_TIMESTAMP_RECEIVED TimestampField = 0
+	TimestampField_TIMESTAMP_STAGE    TimestampField = 1
+	TimestampField_TIMESTAMP_PATH     TimestampField = 2
+)
+
+var TimestampField_name = map[int32]string{
+	0: "TIMESTAMP_RECEIVED",
+	1: "TIMESTAMP_STAGE",
+	2: "TIMESTAMP_PATH",
+}
+
+var TimestampField_value = map[string]int32{
+	"TIMESTAMP_RECEIVED": 0,
+	"TIMESTAMP_STAGE":    1,
+	"TIMESTAMP_PATH":     2,
+}
+
+func (x TimestampField) String() string {
+	return proto.EnumName(TimestampField_name, int32(x))
+}
+
+func (TimestampField) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_5da7706f7097cf70, []int{3}
+}
+
+type MatchType int32
+
+const (
+	MatchType_MATCH_EXACT  MatchType = 0
+	MatchType_MATCH_PREFIX MatchType = 1
+	MatchType_MATCH_REGEX  MatchType = 2
+)
+
+var MatchType_name = map[int32]string{
+	0: "MATCH_EXACT",
+	1: "MATCH_PREFIX",
+	2: "MATCH_REGEX",
+}
+
+var MatchType_value = map[string]int32{
+	"MATCH_EXACT":  0,
+	"MATCH_PREFIX": 1,
+	"MATCH_REGEX":  2,
+}
+
+func (x MatchType) String() string {
+	return proto.EnumName(MatchType_name, int32(x))
+}
+
+func (MatchType) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_5da7706f7097cf70, []int{4}
+}
+
+type Compression int32
+
+const (
+	Compression_COMPRESSION_AUTO  Compression = 0
+	Compression_COMPRESSION_NONE  Compression = 1
+	Compression_COMPRESSION_GZIP  Compression = 2
+	Compression_COMPRESSION_ZSTD  Compression = 3
+	Compression_COMPRESSION_BZIP2 Compression = 4
+	Compression_COMPRESSION_XZ    Compression = 5
+	Compression_COMPRESSION_LZ4   Compression = 6
+)
+
+var Compression_name = map[int32]string{
+	0: "COMPRESSION_AUTO",
+	1: "COMPRESSION_NONE",
+	2: "COMPRESSION_GZIP",
+	3: "COMPRESSION_ZSTD",
+	4: "COMPRESSION_BZIP2",
+	5: "COMPRESSION_XZ",
+	6: "COMPRESSION_LZ4",
+}
+
+var Compression_value = map[string]int32{
+	"COMPRESSION_AUTO":  0,
+	"COMPRESSION_NONE":  1,
+	"COMPRESSION_GZIP":  2,
+	"COMPRESSION_ZSTD":  3,
+	"COMPRESSION_BZIP2": 4,
+	"COMPRESSION_XZ":    5,
+	"COMPRESSION_LZ4":   6,
+}
+
+func (x Compression) String() string {
+	return proto.EnumName(Compression_name, int32(x))
+}
+
+func (Compression) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_5da7706f7097cf70, []int{5}
+}
+
+type AggregatorType int32
+
+const (
+	AggregatorType_AGGREGATOR_COUNT      AggregatorType = 0
+	AggregatorType_AGGREGATOR_SUM        AggregatorType = 1
+	AggregatorType_AGGREGATOR_MIN        AggregatorType = 2
+	AggregatorType_AGGREGATOR_MAX        AggregatorType = 3
+	AggregatorType_AGGREGATOR_PERCENTILE AggregatorType = 4
+)
+
+var AggregatorType_name = map[int32]string{
+	0: "AGGREGATOR_COUNT",
+	1: "AGGREGATOR_SUM",
+	2: "AGGREGATOR_MIN",
+	3: "AGGREGATOR_MAX",
+	4: "AGGREGATOR_PERCENTILE",
+}
+
+var AggregatorType_value = map[string]int32{
+	"AGGREGATOR_COUNT":      0,
+	"AGGREGATOR_SUM":        1,
+	"AGGREGATOR_MIN":        2,
+	"AGGREGATOR_MAX":        3,
+	"AGGREGATOR_PERCENTILE": 4,
+}
+
+func (x AggregatorType) String() string {
+	return proto.EnumName(AggregatorType_name, int32(x))
+}
+
+func (AggregatorType) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_5da7706f7097cf70, []int{6}
+}
+
 type Work struct {
-	File                 string               `protobuf:"bytes,1,opt,name=file,proto3" json:"file,omitempty"`
-	TargetSubstring      string               `protobuf:"bytes,2,opt,name=targetSubstring,proto3" json:"targetSubstring,omitempty"`
-	Since                *timestamp.Timestamp `protobuf:"bytes,3,opt,name=since,proto3" json:"since,omitempty"`
-	Until                *timestamp.Timestamp `protobuf:"bytes,4,opt,name=until,proto3" json:"until,omitempty"`
+	File            string               `protobuf:"bytes,1,opt,name=file,proto3" json:"file,omitempty"`
+	TargetSubstring string               `protobuf:"bytes,2,opt,name=targetSubstring,proto3" json:"targetSubstring,omitempty"`
+	Since           *timestamp.Timestamp `protobuf:"bytes,3,opt,name=since,proto3" json:"since,omitempty"`
+	Until           *timestamp.Timestamp `protobuf:"bytes,4,opt,name=until,proto3" json:"until,omitempty"`
+	// Bucket to read file from, the server default is used when empty.
+	Bucket string `protobuf:"bytes,5,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	// Additional object paths, prefixes (ending with "/") or glob patterns.
+	// A "#member" suffix, which may be a glob too, reads tar or zip members.
+	Files []string `protobuf:"bytes,6,rep,name=files,proto3" json:"files,omitempty"`
+	// Compression of the files, detected from their content by default.
+	Compression Compression `protobuf:"varint,7,opt,name=compression,proto3,enum=Compression" json:"compression,omitempty"`
+	// Predicates on parsed audit event fields, all of which must hold.
+	Filters *FieldFilters `protobuf:"bytes,8,opt,name=filters,proto3" json:"filters,omitempty"`
+	// Boolean query over audit event fields, e.g.
+	// verb in (create,update) AND NOT user.username ~ "^system:node:"
+	Query string `protobuf:"bytes,9,opt,name=query,proto3" json:"query,omitempty"`
+	// Dot-separated audit event fields to return instead of whole lines,
+	// one per entry or comma-separated, e.g. "auditID,objectRef.resource".
+	Projection []string `protobuf:"bytes,10,rep,name=projection,proto3" json:"projection,omitempty"`
+	// Timestamp lines are filtered by since and until and reported with.
+	// Lines without the chosen field use requestReceivedTimestamp.
+	TimestampField TimestampField `protobuf:"varint,11,opt,name=timestampField,proto3,enum=TimestampField" json:"timestampField,omitempty"`
+	// Dot-separated path of an RFC 3339 timestamp for TIMESTAMP_PATH, e.g.
+	// "metadata.creationTimestamp".
+	TimestampPath string `protobuf:"bytes,12,opt,name=timestampPath,proto3" json:"timestampPath,omitempty"`
+	// What to do with lines that cannot be parsed as audit events.
+	ErrorPolicy ErrorPolicy `protobuf:"varint,13,opt,name=errorPolicy,proto3,enum=ErrorPolicy" json:"errorPolicy,omitempty"`
+	// Reading stops once this many matching lines, or lines totalling this
+	// many bytes, have been returned. Zero means no limit.
+	MaxLines int64 `protobuf:"varint,14,opt,name=maxLines,proto3" json:"maxLines,omitempty"`
+	MaxBytes int64 `protobuf:"varint,15,opt,name=maxBytes,proto3" json:"maxBytes,omitempty"`
+	// Keep only a deterministic sample of the matching lines.
+	Sampling *Sampling `protobuf:"bytes,16,opt,name=sampling,proto3" json:"sampling,omitempty"`
+	// Resume a broken stream of the same request after the cursor of the
+	// last result received.
+	Cursor *Cursor `protobuf:"bytes,17,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	// Return lines sorted by LogLine.timestamp across all files rather than
+	// in file order. All files are read at once, up to a limit set by the
+	// worker. Ordered results carry no cursors.
+	Ordered bool `protobuf:"varint,18,opt,name=ordered,proto3" json:"ordered,omitempty"`
+	// How far lines may be out of order within a file, 10s when unset.
+	// Lines further behind are returned late and counted in the summary.
+	ReorderWindow *duration.Duration `protobuf:"bytes,19,opt,name=reorderWindow,proto3" json:"reorderWindow,omitempty"`
+	// Group lines of the same auditID, e.g. the stages of a request or
+	// copies of it in the logs of several replicas. A request is returned
+	// once its final stage is read, so lines come in the order requests
+	// finish rather than start. Deduplicated results carry no cursors.
+	Deduplication Deduplication `protobuf:"varint,20,opt,name=deduplication,proto3,enum=Deduplication" json:"deduplication,omitempty"`
+	// How long requests are grouped for, 10m when unset. Requests still
+	// unfinished after lines this much newer were read are returned with
+	// the latest stage so far and their later lines left out. Lines of
+	// requests finished longer ago are no longer recognized as copies.
+	// Combine with ordered to group the logs of several replicas.
+	DeduplicationWindow  *duration.Duration `protobuf:"bytes,21,opt,name=deduplicationWindow,proto3" json:"deduplicationWindow,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
+	XXX_unrecognized     []byte             `json:"-"`
+	XXX_sizecache        int32              `json:"-"`
+}
+
+func (m *Work) Reset()         { *m = Work{} }
+func (m *Work) String() string { return proto.CompactTextString(m) }
+func (*Work) ProtoMessage()    {}
+func (*Work) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5da7706f7097cf70, []int{0}
+}
+
+func (m *Work) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Work.Unmarshal(m, b)
+}
+func (m *Work) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Work.Marshal(b, m, deterministic)
+}
+func (m *Work) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Work.Merge(m, src)
+}
+func (m *Work) XXX_Size() int {
+	return xxx_messageInfo_Work.Size(m)
+}
+func (m *Work) XXX_DiscardUnknown() {
+	xxx_messageInfo_Work.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Work proto.InternalMessageInfo
+
+func (m *Work) GetFile() string {
+	if m != nil {
+		return m.File
+	}
+	return ""
+}
+
+func (m *Work) GetTargetSubstring() string {
+	if m != nil {
+		return m.TargetSubstring
+	}
+	return ""
+}
+
+func (m *Work) GetSince() *timestamp.Timestamp {
+	if m != nil {
+		return m.Since
+	}
+	return nil
+}
+
+func (m *Work) GetUntil() *timestamp.Timestamp {
+	if m != nil {
+		return m.Until
+	}
+	return nil
+}
+
+func (m *Work) GetBucket() string {
+	if m != nil {
+		return m.Bucket
+	}
+	return ""
+}
+
+func (m *Work) GetFiles() []string {
+	if m != nil {
+		return m.Files
+	}
+	return nil
+}
+
+func (m *Work) GetCompression() Compression {
+	if m != nil {
+		return m.Compression
+	}
+	return Compression_COMPRESSION_AUTO
+}
+
+func (m *Work) GetFilters() *FieldFilters {
+	if m != nil {
+		return m.Filters
+	}
+	return nil
+}
+
+func (m *Work) GetQuery() string {
+	if m != nil {
+		return m.Query
+	}
+	return ""
+}
+
+func (m *Work) GetProjection() []string {
+	if m != nil {
+		return m.Projection
+	}
+	return nil
+}
+
+func (m *Work) GetTimestampField() TimestampField {
+	if m != nil {
+		return m.TimestampField
+	}
+	return TimestampField_TIMESTAMP_RECEIVED
+}
+
+func (m *Work) GetTimestampPath() string {
+	if m != nil {
+		return m.TimestampPath
+	}
+	return ""
+}
+
+func (m *Work) GetErrorPolicy() ErrorPolicy {
+	if m != nil {
+		return m.ErrorPolicy
+	}
+	return ErrorPolicy_ERROR_POLICY_SKIP
+}
+
+func (m *Work) GetMaxLines() int64 {
+	if m != nil {
+		return m.MaxLines
+	}
+	return 0
+}
+
+func (m *Work) GetMaxBytes() int64 {
+	if m != nil {
+		return m.MaxBytes
+	}
+	return 0
+}
+
+func (m *Work) GetSampling() *Sampling {
+	if m != nil {
+		return m.Sampling
+	}
+	return nil
+}
+
+func (m *Work) GetCursor() *Cursor {
+	if m != nil {
+		return m.Cursor
+	}
+	return nil
+}
+
+func (m *Work) GetOrdered() bool {
+	if m != nil {
+		return m.Ordered
+	}
+	return false
+}
+
+func (m *Work) GetReorderWindow() *duration.Duration {
+	if m != nil {
+		return m.ReorderWindow
+	}
+	return nil
+}
+
+func (m *Work) GetDeduplication() Deduplication {
+	if m != nil {
+		return m.Deduplication
+	}
+	return Deduplication_DEDUPLICATION_NONE
+}
+
+func (m *Work) GetDeduplicationWindow() *duration.Duration {
+	if m != nil {
+		return m.DeduplicationWindow
+	}
+	return nil
+}
+
+// Position just past the last line returned so far.
+type Cursor struct {
+	// Source of the line, as in LogLine.source.
+	Source string `protobuf:"bytes,1,opt,name=source,proto3" json:"source,omitempty"`
+	// Uncompressed byte offset in the source.
+	Offset int64 `protobuf:"varint,2,opt,name=offset,proto3" json:"offset,omitempty"`
+	// 1-based number of the line in the source.
+	LineNumber           int64    `protobuf:"varint,3,opt,name=lineNumber,proto3" json:"lineNumber,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Cursor) Reset()         { *m = Cursor{} }
+func (m *Cursor) String() string { return proto.CompactTextString(m) }
+func (*Cursor) ProtoMessage()    {}
+func (*Cursor) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5da7706f7097cf70, []int{1}
+}
+
+func (m *Cursor) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Cursor.Unmarshal(m, b)
+}
+func (m *Cursor) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Cursor.Marshal(b, m, deterministic)
+}
+func (m *Cursor) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Cursor.Merge(m, src)
+}
+func (m *Cursor) XXX_Size() int {
+	return xxx_messageInfo_Cursor.Size(m)
+}
+func (m *Cursor) XXX_DiscardUnknown() {
+	xxx_messageInfo_Cursor.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Cursor proto.InternalMessageInfo
+
+func (m *Cursor) GetSource() string {
+	if m != nil {
+		return m.Source
+	}
+	return ""
+}
+
+func (m *Cursor) GetOffset() int64 {
+	if m != nil {
+		return m.Offset
+	}
+	return 0
+}
+
+func (m *Cursor) GetLineNumber() int64 {
+	if m != nil {
+		return m.LineNumber
+	}
+	return 0
+}
+
+type Sampling struct {
+	Mode SamplingMode `protobuf:"varint,1,opt,name=mode,proto3,enum=SamplingMode" json:"mode,omitempty"`
+	// Fraction of lines to keep, between 0 and 1.
+	Rate                 float64  `protobuf:"fixed64,2,opt,name=rate,proto3" json:"rate,omitempty"`
+	Seed                 int64    `protobuf:"varint,3,opt,name=seed,proto3" json:"seed,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Sampling) Reset()         { *m = Sampling{} }
+func (m *Sampling) String() string { return proto.CompactTextString(m) }
+func (*Sampling) ProtoMessage()    {}
+func (*Sampling) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5da7706f7097cf70, []int{2}
+}
+
+func (m *Sampling) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Sampling.Unmarshal(m, b)
+}
+func (m *Sampling) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Sampling.Marshal(b, m, deterministic)
+}
+func (m *Sampling) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Sampling.Merge(m, src)
+}
+func (m *Sampling) XXX_Size() int {
+	return xxx_messageInfo_Sampling.Size(m)
+}
+func (m *Sampling) XXX_DiscardUnknown() {
+	xxx_messageInfo_Sampling.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Sampling proto.InternalMessageInfo
+
+func (m *Sampling) GetMode() SamplingMode {
+	if m != nil {
+		return m.Mode
+	}
+	return SamplingMode_SAMPLING_RANDOM
+}
+
+func (m *Sampling) GetRate() float64 {
+	if m != nil {
+		return m.Rate
+	}
+	return 0
+}
+
+func (m *Sampling) GetSeed() int64 {
+	if m != nil {
+		return m.Seed
+	}
+	return 0
+}
+
+type StringMatch struct {
+	Type                 MatchType `protobuf:"varint,1,opt,name=type,proto3,enum=MatchType" json:"type,omitempty"`
+	Value                string    `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
+	XXX_unrecognized     []byte    `json:"-"`
+	XXX_sizecache        int32     `json:"-"`
+}
+
+func (m *StringMatch) Reset()         { *m = StringMatch{} }
+func (m *StringMatch) String() string { return proto.CompactTextString(m) }
+func (*StringMatch) ProtoMessage()    {}
+func (*StringMatch) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5da7706f7097cf70, []int{3}
+}
+
+func (m *StringMatch) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_StringMatch.Unmarshal(m, b)
+}
+func (m *StringMatch) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_StringMatch.Marshal(b, m, deterministic)
+}
+func (m *StringMatch) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_StringMatch.Merge(m, src)
+}
+func (m *StringMatch) XXX_Size() int {
+	return xxx_messageInfo_StringMatch.Size(m)
+}
+func (m *StringMatch) XXX_DiscardUnknown() {
+	xxx_messageInfo_StringMatch.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_StringMatch proto.InternalMessageInfo
+
+func (m *StringMatch) GetType() MatchType {
+	if m != nil {
+		return m.Type
+	}
+	return MatchType_MATCH_EXACT
+}
+
+func (m *StringMatch) GetValue() string {
+	if m != nil {
+		return m.Value
+	}
+	return ""
+}
+
+// Inclusive range of response codes, an unset bound is open.
+type CodeRange struct {
+	Min                  int32    `protobuf:"varint,1,opt,name=min,proto3" json:"min,omitempty"`
+	Max                  int32    `protobuf:"varint,2,opt,name=max,proto3" json:"max,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CodeRange) Reset()         { *m = CodeRange{} }
+func (m *CodeRange) String() string { return proto.CompactTextString(m) }
+func (*CodeRange) ProtoMessage()    {}
+func (*CodeRange) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5da7706f7097cf70, []int{4}
+}
+
+func (m *CodeRange) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CodeRange.Unmarshal(m, b)
+}
+func (m *CodeRange) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CodeRange.Marshal(b, m, deterministic)
+}
+func (m *CodeRange) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CodeRange.Merge(m, src)
+}
+func (m *CodeRange) XXX_Size() int {
+	return xxx_messageInfo_CodeRange.Size(m)
+}
+func (m *CodeRange) XXX_DiscardUnknown() {
+	xxx_messageInfo_CodeRange.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CodeRange proto.InternalMessageInfo
+
+func (m *CodeRange) GetMin() int32 {
+	if m != nil {
+		return m.Min
+	}
+	return 0
+}
+
+func (m *CodeRange) GetMax() int32 {
+	if m != nil {
+		return m.Max
+	}
+	return 0
+}
+
+// Inclusive range of request latency, from requestReceivedTimestamp to
+// stageTimestamp. An unset bound is open.
+type LatencyRange struct {
+	Min                  *duration.Duration `protobuf:"bytes,1,opt,name=min,proto3" json:"min,omitempty"`
+	Max                  *duration.Duration `protobuf:"bytes,2,opt,name=max,proto3" json:"max,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
+	XXX_unrecognized     []byte             `json:"-"`
+	XXX_sizecache        int32              `json:"-"`
+}
+
+func (m *LatencyRange) Reset()         { *m = LatencyRange{} }
+func (m *LatencyRange) String() string { return proto.CompactTextString(m) }
+func (*LatencyRange) ProtoMessage()    {}
+func (*LatencyRange) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5da7706f7097cf70, []int{5}
+}
+
+func (m *LatencyRange) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_LatencyRange.Unmarshal(m, b)
+}
+func (m *LatencyRange) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_LatencyRange.Marshal(b, m, deterministic)
+}
+func (m *LatencyRange) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_LatencyRange.Merge(m, src)
+}
+func (m *LatencyRange) XXX_Size() int {
+	return xxx_messageInfo_LatencyRange.Size(m)
+}
+func (m *LatencyRange) XXX_DiscardUnknown() {
+	xxx_messageInfo_LatencyRange.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_LatencyRange proto.InternalMessageInfo
+
+func (m *LatencyRange) GetMin() *duration.Duration {
+	if m != nil {
+		return m.Min
+	}
+	return nil
+}
+
+func (m *LatencyRange) GetMax() *duration.Duration {
+	if m != nil {
+		return m.Max
+	}
+	return nil
+}
+
+// A field passes when any of its matches does, an empty list passes
+// everything.
+type FieldFilters struct {
+	Verb                 []*StringMatch  `protobuf:"bytes,1,rep,name=verb,proto3" json:"verb,omitempty"`
+	Username             []*StringMatch  `protobuf:"bytes,2,rep,name=username,proto3" json:"username,omitempty"`
+	UserGroup            []*StringMatch  `protobuf:"bytes,3,rep,name=userGroup,proto3" json:"userGroup,omitempty"`
+	Resource             []*StringMatch  `protobuf:"bytes,4,rep,name=resource,proto3" json:"resource,omitempty"`
+	Subresource          []*StringMatch  `protobuf:"bytes,5,rep,name=subresource,proto3" json:"subresource,omitempty"`
+	Namespace            []*StringMatch  `protobuf:"bytes,6,rep,name=namespace,proto3" json:"namespace,omitempty"`
+	Name                 []*StringMatch  `protobuf:"bytes,7,rep,name=name,proto3" json:"name,omitempty"`
+	ApiGroup             []*StringMatch  `protobuf:"bytes,8,rep,name=apiGroup,proto3" json:"apiGroup,omitempty"`
+	Stage                []*StringMatch  `protobuf:"bytes,9,rep,name=stage,proto3" json:"stage,omitempty"`
+	Level                []*StringMatch  `protobuf:"bytes,10,rep,name=level,proto3" json:"level,omitempty"`
+	ResponseCode         []*CodeRange    `protobuf:"bytes,11,rep,name=responseCode,proto3" json:"responseCode,omitempty"`
+	UserAgent            []*StringMatch  `protobuf:"bytes,12,rep,name=userAgent,proto3" json:"userAgent,omitempty"`
+	SourceIP             []*StringMatch  `protobuf:"bytes,13,rep,name=sourceIP,proto3" json:"sourceIP,omitempty"`
+	Latency              []*LatencyRange `protobuf:"bytes,14,rep,name=latency,proto3" json:"latency,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
+}
+
+func (m *FieldFilters) Reset()         { *m = FieldFilters{} }
+func (m *FieldFilters) String() string { return proto.CompactTextString(m) }
+func (*FieldFilters) ProtoMessage()    {}
+func (*FieldFilters) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5da7706f7097cf70, []int{6}
+}
+
+func (m *FieldFilters) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_FieldFilters.Unmarshal(m, b)
+}
+func (m *FieldFilters) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_FieldFilters.Marshal(b, m, deterministic)
+}
+func (m *FieldFilters) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FieldFilters.Merge(m, src)
+}
+func (m *FieldFilters) XXX_Size() int {
+	return xxx_messageInfo_FieldFilters.Size(m)
+}
+func (m *FieldFilters) XXX_DiscardUnknown() {
+	xxx_messageInfo_FieldFilters.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_FieldFilters proto.InternalMessageInfo
+
+func (m *FieldFilters) GetVerb() []*StringMatch {
+	if m != nil {
+		return m.Verb
+	}
+	return nil
+}
+
+func (m *FieldFilters) GetUsername() []*StringMatch {
+	if m != nil {
+		return m.Username
+	}
+	return nil
+}
+
+func (m *FieldFilters) GetUserGroup() []*StringMatch {
+	if m != nil {
+		return m.UserGroup
+	}
+	return nil
+}
+
+func (m *FieldFilters) GetResource() []*StringMatch {
+	if m != nil {
+		return m.Resource
+	}
+	return nil
+}
+
+func (m *FieldFilters) GetSubresource() []*StringMatch {
+	if m != nil {
+		return m.Subresource
+	}
+	return nil
+}
+
+func (m *FieldFilters) GetNamespace() []*StringMatch {
+	if m != nil {
+		return m.Namespace
+	}
+	return nil
+}
+
+func (m *FieldFilters) GetName() []*StringMatch {
+	if m != nil {
+		return m.Name
+	}
+	return nil
+}
+
+func (m *FieldFilters) GetApiGroup() []*StringMatch {
+	if m != nil {
+		return m.ApiGroup
+	}
+	return nil
+}
+
+func (m *FieldFilters) GetStage() []*StringMatch {
+	if m != nil {
+		return m.Stage
+	}
+	return nil
+}
+
+func (m *FieldFilters) GetLevel() []*StringMatch {
+	if m != nil {
+		return m.Level
+	}
+	return nil
+}
+
+func (m *FieldFilters) GetResponseCode() []*CodeRange {
+	if m != nil {
+		return m.ResponseCode
+	}
+	return nil
+}
+
+func (m *FieldFilters) GetUserAgent() []*StringMatch {
+	if m != nil {
+		return m.UserAgent
+	}
+	return nil
+}
+
+func (m *FieldFilters) GetSourceIP() []*StringMatch {
+	if m != nil {
+		return m.SourceIP
+	}
+	return nil
+}
+
+func (m *FieldFilters) GetLatency() []*LatencyRange {
+	if m != nil {
+		return m.Latency
+	}
+	return nil
+}
+
+type LogLine struct {
+	Timestamp *timestamp.Timestamp `protobuf:"bytes,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Entry     string               `protobuf:"bytes,2,opt,name=entry,proto3" json:"entry,omitempty"`
+	// Object the line was read from.
+	Source string `protobuf:"bytes,3,opt,name=source,proto3" json:"source,omitempty"`
+	// JSON document with only the projected fields, set instead of entry
+	// when the request has a projection.
+	Projection string `protobuf:"bytes,4,opt,name=projection,proto3" json:"projection,omitempty"`
+	// Time from receiving the request until the event's stage, unset when
+	// the line has no stage timestamp.
+	Latency *duration.Duration `protobuf:"bytes,5,opt,name=latency,proto3" json:"latency,omitempty"`
+	// Stages of the request, only with DEDUPLICATION_COMBINED.
+	Stages               *Stages  `protobuf:"bytes,6,opt,name=stages,proto3" json:"stages,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *LogLine) Reset()         { *m = LogLine{} }
+func (m *LogLine) String() string { return proto.CompactTextString(m) }
+func (*LogLine) ProtoMessage()    {}
+func (*LogLine) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5da7706f7097cf70, []int{7}
+}
+
+func (m *LogLine) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_LogLine.Unmarshal(m, b)
+}
+func (m *LogLine) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_LogLine.Marshal(b, m, deterministic)
+}
+func (m *LogLine) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_LogLine.Merge(m, src)
+}
+func (m *LogLine) XXX_Size() int {
+	return xxx_messageInfo_LogLine.Size(m)
+}
+func (m *LogLine) XXX_DiscardUnknown() {
+	xxx_messageInfo_LogLine.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_LogLine proto.InternalMessageInfo
+
+func (m *LogLine) GetTimestamp() *timestamp.Timestamp {
+	if m != nil {
+		return m.Timestamp
+	}
+	return nil
+}
+
+func (m *LogLine) GetEntry() string {
+	if m != nil {
+		return m.Entry
+	}
+	return ""
+}
+
+func (m *LogLine) GetSource() string {
+	if m != nil {
+		return m.Source
+	}
+	return ""
+}
+
+func (m *LogLine) GetProjection() string {
+	if m != nil {
+		return m.Projection
+	}
+	return ""
+}
+
+func (m *LogLine) GetLatency() *duration.Duration {
+	if m != nil {
+		return m.Latency
+	}
+	return nil
+}
+
+func (m *LogLine) GetStages() *Stages {
+	if m != nil {
+		return m.Stages
+	}
+	return nil
+}
+
+// Stage timestamps of a request, unset for stages that were not read.
+type Stages struct {
+	RequestReceived  *timestamp.Timestamp `protobuf:"bytes,1,opt,name=requestReceived,proto3" json:"requestReceived,omitempty"`
+	ResponseStarted  *timestamp.Timestamp `protobuf:"bytes,2,opt,name=responseStarted,proto3" json:"responseStarted,omitempty"`
+	ResponseComplete *timestamp.Timestamp `protobuf:"bytes,3,opt,name=responseComplete,proto3" json:"responseComplete,omitempty"`
+	Panic            *timestamp.Timestamp `protobuf:"bytes,4,opt,name=panic,proto3" json:"panic,omitempty"`
+	// Time from receiving the request until ResponseStarted, which only
+	// long-running requests such as watches have.
+	TimeToFirstByte *duration.Duration `protobuf:"bytes,5,opt,name=timeToFirstByte,proto3" json:"timeToFirstByte,omitempty"`
+	// Time from receiving the request until ResponseComplete or Panic.
+	Duration             *duration.Duration `protobuf:"bytes,6,opt,name=duration,proto3" json:"duration,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
+	XXX_unrecognized     []byte             `json:"-"`
+	XXX_sizecache        int32              `json:"-"`
+}
+
+func (m *Stages) Reset()         { *m = Stages{} }
+func (m *Stages) String() string { return proto.CompactTextString(m) }
+func (*Stages) ProtoMessage()    {}
+func (*Stages) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5da7706f7097cf70, []int{8}
+}
+
+func (m *Stages) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Stages.Unmarshal(m, b)
+}
+func (m *Stages) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Stages.Marshal(b, m, deterministic)
+}
+func (m *Stages) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Stages.Merge(m, src)
+}
+func (m *Stages) XXX_Size() int {
+	return xxx_messageInfo_Stages.Size(m)
+}
+func (m *Stages) XXX_DiscardUnknown() {
+	xxx_messageInfo_Stages.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Stages proto.InternalMessageInfo
+
+func (m *Stages) GetRequestReceived() *timestamp.Timestamp {
+	if m != nil {
+		return m.RequestReceived
+	}
+	return nil
+}
+
+func (m *Stages) GetResponseStarted() *timestamp.Timestamp {
+	if m != nil {
+		return m.ResponseStarted
+	}
+	return nil
+}
+
+func (m *Stages) GetResponseComplete() *timestamp.Timestamp {
+	if m != nil {
+		return m.ResponseComplete
+	}
+	return nil
+}
+
+func (m *Stages) GetPanic() *timestamp.Timestamp {
+	if m != nil {
+		return m.Panic
+	}
+	return nil
+}
+
+func (m *Stages) GetTimeToFirstByte() *duration.Duration {
+	if m != nil {
+		return m.TimeToFirstByte
+	}
+	return nil
+}
+
+func (m *Stages) GetDuration() *duration.Duration {
+	if m != nil {
+		return m.Duration
+	}
+	return nil
+}
+
+type MalformedLine struct {
+	Source string `protobuf:"bytes,1,opt,name=source,proto3" json:"source,omitempty"`
+	// 1-based line number within the source.
+	LineNumber int64 `protobuf:"varint,2,opt,name=lineNumber,proto3" json:"lineNumber,omitempty"`
+	// Start of the line, cut to at most 1KiB.
+	Line  string `protobuf:"bytes,3,opt,name=line,proto3" json:"line,omitempty"`
+	Error string `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	// The line is the last of the source and has no line terminator.
+	Truncated            bool     `protobuf:"varint,5,opt,name=truncated,proto3" json:"truncated,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *MalformedLine) Reset()         { *m = MalformedLine{} }
+func (m *MalformedLine) String() string { return proto.CompactTextString(m) }
+func (*MalformedLine) ProtoMessage()    {}
+func (*MalformedLine) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5da7706f7097cf70, []int{9}
+}
+
+func (m *MalformedLine) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_MalformedLine.Unmarshal(m, b)
+}
+func (m *MalformedLine) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_MalformedLine.Marshal(b, m, deterministic)
+}
+func (m *MalformedLine) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MalformedLine.Merge(m, src)
+}
+func (m *MalformedLine) XXX_Size() int {
+	return xxx_messageInfo_MalformedLine.Size(m)
+}
+func (m *MalformedLine) XXX_DiscardUnknown() {
+	xxx_messageInfo_MalformedLine.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MalformedLine proto.InternalMessageInfo
+
+func (m *MalformedLine) GetSource() string {
+	if m != nil {
+		return m.Source
+	}
+	return ""
+}
+
+func (m *MalformedLine) GetLineNumber() int64 {
+	if m != nil {
+		return m.LineNumber
+	}
+	return 0
+}
+
+func (m *MalformedLine) GetLine() string {
+	if m != nil {
+		return m.Line
+	}
+	return ""
+}
+
+func (m *MalformedLine) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func (m *MalformedLine) GetTruncated() bool {
+	if m != nil {
+		return m.Truncated
+	}
+	return false
+}
+
+type WorkSummary struct {
+	MalformedLines int64 `protobuf:"varint,1,opt,name=malformedLines,proto3" json:"malformedLines,omitempty"`
+	// Malformed lines that were the unterminated end of a source.
+	TruncatedLines int64 `protobuf:"varint,2,opt,name=truncatedLines,proto3" json:"truncatedLines,omitempty"`
+	// Matching lines left out of the results because of errors.
+	SkippedLines int64 `protobuf:"varint,3,opt,name=skippedLines,proto3" json:"skippedLines,omitempty"`
+	// Uncompressed bytes read from all sources.
+	BytesRead    int64 `protobuf:"varint,4,opt,name=bytesRead,proto3" json:"bytesRead,omitempty"`
+	LinesScanned int64 `protobuf:"varint,5,opt,name=linesScanned,proto3" json:"linesScanned,omitempty"`
+	// Lines passing all filters, including those skipped later.
+	LinesMatched int64 `protobuf:"varint,6,opt,name=linesMatched,proto3" json:"linesMatched,omitempty"`
+	// gRPC status code and message of the error that ended reading early,
+	// unset when every source was read completely.
+	Code  int32  `protobuf:"varint,7,opt,name=code,proto3" json:"code,omitempty"`
+	Error string `protobuf:"bytes,8,opt,name=error,proto3" json:"error,omitempty"`
+	// Reading stopped early because maxLines or maxBytes was reached.
+	LimitReached bool `protobuf:"varint,9,opt,name=limitReached,proto3" json:"limitReached,omitempty"`
+	// Lines of ordered results returned after later ones, because they were
+	// further behind in their file than the reorder window.
+	LateLines int64 `protobuf:"varint,10,opt,name=lateLines,proto3" json:"lateLines,omitempty"`
+	// Lines left out because another line of the same auditID was
+	// returned instead.
+	DuplicateLines       int64    `protobuf:"varint,11,opt,name=duplicateLines,proto3" json:"duplicateLines,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *WorkSummary) Reset()         { *m = WorkSummary{} }
+func (m *WorkSummary) String() string { return proto.CompactTextString(m) }
+func (*WorkSummary) ProtoMessage()    {}
+func (*WorkSummary) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5da7706f7097cf70, []int{10}
+}
+
+func (m *WorkSummary) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_WorkSummary.Unmarshal(m, b)
+}
+func (m *WorkSummary) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_WorkSummary.Marshal(b, m, deterministic)
+}
+func (m *WorkSummary) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_WorkSummary.Merge(m, src)
+}
+func (m *WorkSummary) XXX_Size() int {
+	return xxx_messageInfo_WorkSummary.Size(m)
+}
+func (m *WorkSummary) XXX_DiscardUnknown() {
+	xxx_messageInfo_WorkSummary.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_WorkSummary proto.InternalMessageInfo
+
+func (m *WorkSummary) GetMalformedLines() int64 {
+	if m != nil {
+		return m.MalformedLines
+	}
+	return 0
+}
+
+func (m *WorkSummary) GetTruncatedLines() int64 {
+	if m != nil {
+		return m.TruncatedLines
+	}
+	return 0
+}
+
+func (m *WorkSummary) GetSkippedLines() int64 {
+	if m != nil {
+		return m.SkippedLines
+	}
+	return 0
+}
+
+func (m *WorkSummary) GetBytesRead() int64 {
+	if m != nil {
+		return m.BytesRead
+	}
+	return 0
+}
+
+func (m *WorkSummary) GetLinesScanned() int64 {
+	if m != nil {
+		return m.LinesScanned
+	}
+	return 0
+}
+
+func (m *WorkSummary) GetLinesMatched() int64 {
+	if m != nil {
+		return m.LinesMatched
+	}
+	return 0
+}
+
+func (m *WorkSummary) GetCode() int32 {
+	if m != nil {
+		return m.Code
+	}
+	return 0
+}
+
+func (m *WorkSummary) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func (m *WorkSummary) GetLimitReached() bool {
+	if m != nil {
+		return m.LimitReached
+	}
+	return false
+}
+
+func (m *WorkSummary) GetLateLines() int64 {
+	if m != nil {
+		return m.LateLines
+	}
+	return 0
+}
+
+func (m *WorkSummary) GetDuplicateLines() int64 {
+	if m != nil {
+		return m.DuplicateLines
+	}
+	return 0
+}
+
+type WorkResult struct {
+	LogLines []*LogLine `protobuf:"bytes,1,rep,name=logLines,proto3" json:"logLines,omitempty"`
+	// Samples of malformed lines, only with ERROR_POLICY_REPORT.
+	MalformedLines []*MalformedLine `protobuf:"bytes,2,rep,name=malformedLines,proto3" json:"malformedLines,omitempty"`
+	// Set on the last result of a request only.
+	Summary *WorkSummary `protobuf:"bytes,3,opt,name=summary,proto3" json:"summary,omitempty"`
+	// Where to resume if the stream breaks after this result.
+	Cursor               *Cursor  `protobuf:"bytes,4,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *WorkResult) Reset()         { *m = WorkResult{} }
+func (m *WorkResult) String() string { return proto.CompactTextString(m) }
+func (*WorkResult) ProtoMessage()    {}
+func (*WorkResult) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5da7706f7097cf70, []int{11}
+}
+
+func (m *WorkResult) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_WorkResult.Unmarshal(m, b)
+}
+func (m *WorkResult) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_WorkResult.Marshal(b, m, deterministic)
+}
+func (m *WorkResult) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_WorkResult.Merge(m, src)
+}
+func (m *WorkResult) XXX_Size() int {
+	return xxx_messageInfo_WorkResult.Size(m)
+}
+func (m *WorkResult) XXX_DiscardUnknown() {
+	xxx_messageInfo_WorkResult.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_WorkResult proto.InternalMessageInfo
+
+func (m *WorkResult) GetLogLines() []*LogLine {
+	if m != nil {
+		return m.LogLines
+	}
+	return nil
+}
+
+func (m *WorkResult) GetMalformedLines() []*MalformedLine {
+	if m != nil {
+		return m.MalformedLines
+	}
+	return nil
+}
+
+func (m *WorkResult) GetSummary() *WorkSummary {
+	if m != nil {
+		return m.Summary
+	}
+	return nil
+}
+
+func (m *WorkResult) GetCursor() *Cursor {
+	if m != nil {
+		return m.Cursor
+	}
+	return nil
+}
+
+type ListFilesRequest struct {
+	// Bucket to list, the server default is used when empty.
+	Bucket string `protobuf:"bytes,1,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	Prefix string `protobuf:"bytes,2,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	// Optional glob pattern matched against the object name after prefix.
+	Glob                 string   `protobuf:"bytes,3,opt,name=glob,proto3" json:"glob,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListFilesRequest) Reset()         { *m = ListFilesRequest{} }
+func (m *ListFilesRequest) String() string { return proto.CompactTextString(m) }
+func (*ListFilesRequest) ProtoMessage()    {}
+func (*ListFilesRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5da7706f7097cf70, []int{12}
+}
+
+func (m *ListFilesRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListFilesRequest.Unmarshal(m, b)
+}
+func (m *ListFilesRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListFilesRequest.Marshal(b, m, deterministic)
+}
+func (m *ListFilesRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListFilesRequest.Merge(m, src)
+}
+func (m *ListFilesRequest) XXX_Size() int {
+	return xxx_messageInfo_ListFilesRequest.Size(m)
+}
+func (m *ListFilesRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListFilesRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListFilesRequest proto.InternalMessageInfo
+
+func (m *ListFilesRequest) GetBucket() string {
+	if m != nil {
+		return m.Bucket
+	}
+	return ""
+}
+
+func (m *ListFilesRequest) GetPrefix() string {
+	if m != nil {
+		return m.Prefix
+	}
+	return ""
+}
+
+func (m *ListFilesRequest) GetGlob() string {
+	if m != nil {
+		return m.Glob
+	}
+	return ""
+}
+
+type FileInfo struct {
+	Name                 string               `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Size                 int64                `protobuf:"varint,2,opt,name=size,proto3" json:"size,omitempty"`
+	Generation           int64                `protobuf:"varint,3,opt,name=generation,proto3" json:"generation,omitempty"`
+	ContentEncoding      string               `protobuf:"bytes,4,opt,name=contentEncoding,proto3" json:"contentEncoding,omitempty"`
+	Updated              *timestamp.Timestamp `protobuf:"bytes,5,opt,name=updated,proto3" json:"updated,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
 	XXX_unrecognized     []byte               `json:"-"`
 	XXX_sizecache        int32                `json:"-"`
 }
 
-func (m *Work) Reset()         { *m = Work{} }
-func (m *Work) String() string { return proto.CompactTextString(m) }
-func (*Work) ProtoMessage()    {}
-func (*Work) Descriptor() ([]byte, []int) {
-	return fileDescriptor_5da7706f7097cf70, []int{0}
+func (m *FileInfo) Reset()         { *m = FileInfo{} }
+func (m *FileInfo) String() string { return proto.CompactTextString(m) }
+func (*FileInfo) ProtoMessage()    {}
+func (*FileInfo) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5da7706f7097cf70, []int{13}
+}
+
+func (m *FileInfo) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_FileInfo.Unmarshal(m, b)
+}
+func (m *FileInfo) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_FileInfo.Marshal(b, m, deterministic)
+}
+func (m *FileInfo) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FileInfo.Merge(m, src)
+}
+func (m *FileInfo) XXX_Size() int {
+	return xxx_messageInfo_FileInfo.Size(m)
+}
+func (m *FileInfo) XXX_DiscardUnknown() {
+	xxx_messageInfo_FileInfo.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_FileInfo proto.InternalMessageInfo
+
+func (m *FileInfo) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
 }
 
-func (m *Work) XXX_Unmarshal(b []byte) error {
-	return xxx_messageInfo_Work.Unmarshal(m, b)
+func (m *FileInfo) GetSize() int64 {
+	if m != nil {
+		return m.Size
+	}
+	return 0
 }
-func (m *Work) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
-	return xxx_messageInfo_Work.Marshal(b, m, deterministic)
+
+func (m *FileInfo) GetGeneration() int64 {
+	if m != nil {
+		return m.Generation
+	}
+	return 0
 }
-func (m *Work) XXX_Merge(src proto.Message) {
-	xxx_messageInfo_Work.Merge(m, src)
+
+func (m *FileInfo) GetContentEncoding() string {
+	if m != nil {
+		return m.ContentEncoding
+	}
+	return ""
 }
-func (m *Work) XXX_Size() int {
-	return xxx_messageInfo_Work.Size(m)
+
+func (m *FileInfo) GetUpdated() *timestamp.Timestamp {
+	if m != nil {
+		return m.Updated
+	}
+	return nil
 }
-func (m *Work) XXX_DiscardUnknown() {
-	xxx_messageInfo_Work.DiscardUnknown(m)
+
+type ListFilesResult struct {
+	Files                []*FileInfo `protobuf:"bytes,1,rep,name=files,proto3" json:"files,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
+	XXX_unrecognized     []byte      `json:"-"`
+	XXX_sizecache        int32       `json:"-"`
 }
 
-var xxx_messageInfo_Work proto.InternalMessageInfo
+func (m *ListFilesResult) Reset()         { *m = ListFilesResult{} }
+func (m *ListFilesResult) String() string { return proto.CompactTextString(m) }
+func (*ListFilesResult) ProtoMessage()    {}
+func (*ListFilesResult) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5da7706f7097cf70, []int{14}
+}
 
-func (m *Work) GetFile() string {
+func (m *ListFilesResult) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListFilesResult.Unmarshal(m, b)
+}
+func (m *ListFilesResult) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListFilesResult.Marshal(b, m, deterministic)
+}
+func (m *ListFilesResult) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListFilesResult.Merge(m, src)
+}
+func (m *ListFilesResult) XXX_Size() int {
+	return xxx_messageInfo_ListFilesResult.Size(m)
+}
+func (m *ListFilesResult) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListFilesResult.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListFilesResult proto.InternalMessageInfo
+
+func (m *ListFilesResult) GetFiles() []*FileInfo {
 	if m != nil {
-		return m.File
+		return m.Files
 	}
-	return ""
+	return nil
 }
 
-func (m *Work) GetTargetSubstring() string {
+type Aggregator struct {
+	Type AggregatorType `protobuf:"varint,1,opt,name=type,proto3,enum=AggregatorType" json:"type,omitempty"`
+	// Numeric audit event field, unused for counting.
+	Field string `protobuf:"bytes,2,opt,name=field,proto3" json:"field,omitempty"`
+	// Percentile between 0 and 100 for AGGREGATOR_PERCENTILE.
+	Percentile           float64  `protobuf:"fixed64,3,opt,name=percentile,proto3" json:"percentile,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Aggregator) Reset()         { *m = Aggregator{} }
+func (m *Aggregator) String() string { return proto.CompactTextString(m) }
+func (*Aggregator) ProtoMessage()    {}
+func (*Aggregator) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5da7706f7097cf70, []int{15}
+}
+
+func (m *Aggregator) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Aggregator.Unmarshal(m, b)
+}
+func (m *Aggregator) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Aggregator.Marshal(b, m, deterministic)
+}
+func (m *Aggregator) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Aggregator.Merge(m, src)
+}
+func (m *Aggregator) XXX_Size() int {
+	return xxx_messageInfo_Aggregator.Size(m)
+}
+func (m *Aggregator) XXX_DiscardUnknown() {
+	xxx_messageInfo_Aggregator.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Aggregator proto.InternalMessageInfo
+
+func (m *Aggregator) GetType() AggregatorType {
 	if m != nil {
-		return m.TargetSubstring
+		return m.Type
+	}
+	return AggregatorType_AGGREGATOR_COUNT
+}
+
+func (m *Aggregator) GetField() string {
+	if m != nil {
+		return m.Field
 	}
 	return ""
 }
 
-func (m *Work) GetSince() *timestamp.Timestamp {
+func (m *Aggregator) GetPercentile() float64 {
 	if m != nil {
-		return m.Since
+		return m.Percentile
+	}
+	return 0
+}
+
+type AggregateRequest struct {
+	// Objects and filters selecting the lines to aggregate. Projections,
+	// cursors, ordered and deduplicated results are not supported.
+	Work *Work `protobuf:"bytes,1,opt,name=work,proto3" json:"work,omitempty"`
+	// Audit event fields to group lines by.
+	GroupBy []string `protobuf:"bytes,2,rep,name=groupBy,proto3" json:"groupBy,omitempty"`
+	// Width of time buckets, lines are not bucketed when unset.
+	TimeBucket           *duration.Duration `protobuf:"bytes,3,opt,name=timeBucket,proto3" json:"timeBucket,omitempty"`
+	Aggregators          []*Aggregator      `protobuf:"bytes,4,rep,name=aggregators,proto3" json:"aggregators,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
+	XXX_unrecognized     []byte             `json:"-"`
+	XXX_sizecache        int32              `json:"-"`
+}
+
+func (m *AggregateRequest) Reset()         { *m = AggregateRequest{} }
+func (m *AggregateRequest) String() string { return proto.CompactTextString(m) }
+func (*AggregateRequest) ProtoMessage()    {}
+func (*AggregateRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5da7706f7097cf70, []int{16}
+}
+
+func (m *AggregateRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AggregateRequest.Unmarshal(m, b)
+}
+func (m *AggregateRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AggregateRequest.Marshal(b, m, deterministic)
+}
+func (m *AggregateRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AggregateRequest.Merge(m, src)
+}
+func (m *AggregateRequest) XXX_Size() int {
+	return xxx_messageInfo_AggregateRequest.Size(m)
+}
+func (m *AggregateRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_AggregateRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AggregateRequest proto.InternalMessageInfo
+
+func (m *AggregateRequest) GetWork() *Work {
+	if m != nil {
+		return m.Work
 	}
 	return nil
 }
 
-func (m *Work) GetUntil() *timestamp.Timestamp {
+func (m *AggregateRequest) GetGroupBy() []string {
 	if m != nil {
-		return m.Until
+		return m.GroupBy
 	}
 	return nil
 }
 
-type LogLine struct {
-	Timestamp            *timestamp.Timestamp `protobuf:"bytes,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
-	Entry                string               `protobuf:"bytes,2,opt,name=entry,proto3" json:"entry,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
-	XXX_unrecognized     []byte               `json:"-"`
-	XXX_sizecache        int32                `json:"-"`
+func (m *AggregateRequest) GetTimeBucket() *duration.Duration {
+	if m != nil {
+		return m.TimeBucket
+	}
+	return nil
 }
 
-func (m *LogLine) Reset()         { *m = LogLine{} }
-func (m *LogLine) String() string { return proto.CompactTextString(m) }
-func (*LogLine) ProtoMessage()    {}
-func (*LogLine) Descriptor() ([]byte, []int) {
-	return fileDescriptor_5da7706f7097cf70, []int{1}
+func (m *AggregateRequest) GetAggregators() []*Aggregator {
+	if m != nil {
+		return m.Aggregators
+	}
+	return nil
 }
 
-func (m *LogLine) XXX_Unmarshal(b []byte) error {
-	return xxx_messageInfo_LogLine.Unmarshal(m, b)
+type AggregateRow struct {
+	// Start of the time bucket, unset without bucketing.
+	Bucket *timestamp.Timestamp `protobuf:"bytes,1,opt,name=bucket,proto3" json:"bucket,omitempty"`
+	// Values of the groupBy fields, in request order.
+	Keys []string `protobuf:"bytes,2,rep,name=keys,proto3" json:"keys,omitempty"`
+	// Results of the aggregators, in request order.
+	Values               []float64 `protobuf:"fixed64,3,rep,packed,name=values,proto3" json:"values,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
+	XXX_unrecognized     []byte    `json:"-"`
+	XXX_sizecache        int32     `json:"-"`
 }
-func (m *LogLine) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
-	return xxx_messageInfo_LogLine.Marshal(b, m, deterministic)
+
+func (m *AggregateRow) Reset()         { *m = AggregateRow{} }
+func (m *AggregateRow) String() string { return proto.CompactTextString(m) }
+func (*AggregateRow) ProtoMessage()    {}
+func (*AggregateRow) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5da7706f7097cf70, []int{17}
 }
-func (m *LogLine) XXX_Merge(src proto.Message) {
-	xxx_messageInfo_LogLine.Merge(m, src)
+
+func (m *AggregateRow) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AggregateRow.Unmarshal(m, b)
 }
-func (m *LogLine) XXX_Size() int {
-	return xxx_messageInfo_LogLine.Size(m)
+func (m *AggregateRow) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AggregateRow.Marshal(b, m, deterministic)
 }
-func (m *LogLine) XXX_DiscardUnknown() {
-	xxx_messageInfo_LogLine.DiscardUnknown(m)
+func (m *AggregateRow) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AggregateRow.Merge(m, src)
+}
+func (m *AggregateRow) XXX_Size() int {
+	return xxx_messageInfo_AggregateRow.Size(m)
+}
+func (m *AggregateRow) XXX_DiscardUnknown() {
+	xxx_messageInfo_AggregateRow.DiscardUnknown(m)
 }
 
-var xxx_messageInfo_LogLine proto.InternalMessageInfo
+var xxx_messageInfo_AggregateRow proto.InternalMessageInfo
 
-func (m *LogLine) GetTimestamp() *timestamp.Timestamp {
+func (m *AggregateRow) GetBucket() *timestamp.Timestamp {
 	if m != nil {
-		return m.Timestamp
+		return m.Bucket
 	}
 	return nil
 }
 
-func (m *LogLine) GetEntry() string {
+func (m *AggregateRow) GetKeys() []string {
 	if m != nil {
-		return m.Entry
+		return m.Keys
 	}
-	return ""
+	return nil
 }
 
-type WorkResult struct {
-	LogLines             []*LogLine `protobuf:"bytes,1,rep,name=logLines,proto3" json:"logLines,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}   `json:"-"`
-	XXX_unrecognized     []byte     `json:"-"`
-	XXX_sizecache        int32      `json:"-"`
+func (m *AggregateRow) GetValues() []float64 {
+	if m != nil {
+		return m.Values
+	}
+	return nil
 }
 
-func (m *WorkResult) Reset()         { *m = WorkResult{} }
-func (m *WorkResult) String() string { return proto.CompactTextString(m) }
-func (*WorkResult) ProtoMessage()    {}
-func (*WorkResult) Descriptor() ([]byte, []int) {
-	return fileDescriptor_5da7706f7097cf70, []int{2}
+type AggregateResult struct {
+	// Names of the groupBy fields followed by those of the aggregators.
+	Columns []string        `protobuf:"bytes,1,rep,name=columns,proto3" json:"columns,omitempty"`
+	Rows    []*AggregateRow `protobuf:"bytes,2,rep,name=rows,proto3" json:"rows,omitempty"`
+	// Lines left out because they could not be parsed.
+	MalformedLines int64 `protobuf:"varint,3,opt,name=malformedLines,proto3" json:"malformedLines,omitempty"`
+	// Set when maxLines or maxBytes of the work stopped reading before
+	// all matching lines were aggregated.
+	LimitReached         bool     `protobuf:"varint,4,opt,name=limitReached,proto3" json:"limitReached,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
-func (m *WorkResult) XXX_Unmarshal(b []byte) error {
-	return xxx_messageInfo_WorkResult.Unmarshal(m, b)
+func (m *AggregateResult) Reset()         { *m = AggregateResult{} }
+func (m *AggregateResult) String() string { return proto.CompactTextString(m) }
+func (*AggregateResult) ProtoMessage()    {}
+func (*AggregateResult) Descriptor() ([]byte, []int) {
+	return fileDescriptor_5da7706f7097cf70, []int{18}
 }
-func (m *WorkResult) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
-	return xxx_messageInfo_WorkResult.Marshal(b, m, deterministic)
+
+func (m *AggregateResult) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AggregateResult.Unmarshal(m, b)
 }
-func (m *WorkResult) XXX_Merge(src proto.Message) {
-	xxx_messageInfo_WorkResult.Merge(m, src)
+func (m *AggregateResult) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AggregateResult.Marshal(b, m, deterministic)
 }
-func (m *WorkResult) XXX_Size() int {
-	return xxx_messageInfo_WorkResult.Size(m)
+func (m *AggregateResult) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AggregateResult.Merge(m, src)
 }
-func (m *WorkResult) XXX_DiscardUnknown() {
-	xxx_messageInfo_WorkResult.DiscardUnknown(m)
+func (m *AggregateResult) XXX_Size() int {
+	return xxx_messageInfo_AggregateResult.Size(m)
+}
+func (m *AggregateResult) XXX_DiscardUnknown() {
+	xxx_messageInfo_AggregateResult.DiscardUnknown(m)
 }
 
-var xxx_messageInfo_WorkResult proto.InternalMessageInfo
+var xxx_messageInfo_AggregateResult proto.InternalMessageInfo
 
-func (m *WorkResult) GetLogLines() []*LogLine {
+func (m *AggregateResult) GetColumns() []string {
 	if m != nil {
-		return m.LogLines
+		return m.Columns
+	}
+	return nil
+}
+
+func (m *AggregateResult) GetRows() []*AggregateRow {
+	if m != nil {
+		return m.Rows
 	}
 	return nil
 }
 
+func (m *AggregateResult) GetMalformedLines() int64 {
+	if m != nil {
+		return m.MalformedLines
+	}
+	return 0
+}
+
+func (m *AggregateResult) GetLimitReached() bool {
+	if m != nil {
+		return m.LimitReached
+	}
+	return false
+}
+
 func init() {
+	proto.RegisterEnum("Deduplication", Deduplication_name, Deduplication_value)
+	proto.RegisterEnum("SamplingMode", SamplingMode_name, SamplingMode_value)
+	proto.RegisterEnum("ErrorPolicy", ErrorPolicy_name, ErrorPolicy_value)
+	proto.RegisterEnum("TimestampField", TimestampField_name, TimestampField_value)
+	proto.RegisterEnum("MatchType", MatchType_name, MatchType_value)
+	proto.RegisterEnum("Compression", Compression_name, Compression_value)
+	proto.RegisterEnum("AggregatorType", AggregatorType_name, AggregatorType_value)
 	proto.RegisterType((*Work)(nil), "Work")
+	proto.RegisterType((*Cursor)(nil), "Cursor")
+	proto.RegisterType((*Sampling)(nil), "Sampling")
+	proto.RegisterType((*StringMatch)(nil), "StringMatch")
+	proto.RegisterType((*CodeRange)(nil), "CodeRange")
+	proto.RegisterType((*LatencyRange)(nil), "LatencyRange")
+	proto.RegisterType((*FieldFilters)(nil), "FieldFilters")
 	proto.RegisterType((*LogLine)(nil), "LogLine")
+	proto.RegisterType((*Stages)(nil), "Stages")
+	proto.RegisterType((*MalformedLine)(nil), "MalformedLine")
+	proto.RegisterType((*WorkSummary)(nil), "WorkSummary")
 	proto.RegisterType((*WorkResult)(nil), "WorkResult")
+	proto.RegisterType((*ListFilesRequest)(nil), "ListFilesRequest")
+	proto.RegisterType((*FileInfo)(nil), "FileInfo")
+	proto.RegisterType((*ListFilesResult)(nil), "ListFilesResult")
+	proto.RegisterType((*Aggregator)(nil), "Aggregator")
+	proto.RegisterType((*AggregateRequest)(nil), "AggregateRequest")
+	proto.RegisterType((*AggregateRow)(nil), "AggregateRow")
+	proto.RegisterType((*AggregateResult)(nil), "AggregateResult")
 }
 
 func init() { proto.RegisterFile("read_work.proto", fileDescriptor_5da7706f7097cf70) }
 
 var fileDescriptor_5da7706f7097cf70 = []byte{
-	// 262 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x84, 0x90, 0xb1, 0x4e, 0xc3, 0x30,
-	0x10, 0x86, 0x31, 0x4d, 0x42, 0x7b, 0x19, 0x2a, 0x59, 0x0c, 0x56, 0x16, 0xa2, 0x88, 0x21, 0x62,
-	0x70, 0xab, 0xb0, 0xf0, 0x00, 0x8c, 0x9d, 0x02, 0x12, 0x62, 0x42, 0x09, 0x5c, 0x2d, 0xab, 0xae,
-	0x5d, 0xd9, 0x8e, 0x10, 0x6f, 0xc4, 0x63, 0xa2, 0xd8, 0x6d, 0x23, 0x31, 0xc0, 0x64, 0xdf, 0xdd,
-	0xff, 0xdf, 0x77, 0x77, 0xb0, 0xb4, 0xd8, 0x7d, 0xbc, 0x7d, 0x1a, 0xbb, 0xe3, 0x07, 0x6b, 0xbc,
-	0x29, 0x6e, 0x84, 0x31, 0x42, 0xe1, 0x2a, 0x44, 0xfd, 0xb0, 0x5d, 0x79, 0xb9, 0x47, 0xe7, 0xbb,
-	0xfd, 0x21, 0x0a, 0xaa, 0x6f, 0x02, 0xc9, 0x8b, 0xb1, 0x3b, 0x4a, 0x21, 0xd9, 0x4a, 0x85, 0x8c,
-	0x94, 0xa4, 0x5e, 0xb4, 0xe1, 0x4f, 0x6b, 0x58, 0xfa, 0xce, 0x0a, 0xf4, 0x4f, 0x43, 0xef, 0xbc,
-	0x95, 0x5a, 0xb0, 0xcb, 0x50, 0xfe, 0x9d, 0xa6, 0x6b, 0x48, 0x9d, 0xd4, 0xef, 0xc8, 0x66, 0x25,
-	0xa9, 0xf3, 0xa6, 0xe0, 0x91, 0xcb, 0x4f, 0x5c, 0xfe, 0x7c, 0xe2, 0xb6, 0x51, 0x38, 0x3a, 0x06,
-	0xed, 0xa5, 0x62, 0xc9, 0xff, 0x8e, 0x20, 0xac, 0x5e, 0xe1, 0x6a, 0x63, 0xc4, 0x46, 0x6a, 0xa4,
-	0x0f, 0xb0, 0x38, 0x2f, 0x12, 0x26, 0xfe, 0xbb, 0xc1, 0x24, 0xa6, 0xd7, 0x90, 0xa2, 0xf6, 0xf6,
-	0xeb, 0xb8, 0x48, 0x0c, 0xaa, 0x06, 0x60, 0x3c, 0x42, 0x8b, 0x6e, 0x50, 0x9e, 0xde, 0xc2, 0x5c,
-	0x45, 0x90, 0x63, 0xa4, 0x9c, 0xd5, 0x79, 0x33, 0xe7, 0x47, 0x72, 0x7b, 0xae, 0x34, 0x77, 0x90,
-	0x8d, 0x1e, 0xb4, 0xb4, 0x84, 0xec, 0xd1, 0x84, 0x23, 0xa6, 0x7c, 0x7c, 0x8a, 0x9c, 0x4f, 0xdd,
-	0xaa, 0x8b, 0x35, 0xe9, 0xb3, 0x30, 0xd4, 0xfd, 0x4f, 0x00, 0x00, 0x00, 0xff, 0xff, 0xee, 0x21,
-	0xf7, 0x39, 0xa0, 0x01, 0x00, 0x00,
+	// 2004 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x58, 0xcb, 0x6e, 0xe3, 0xc8,
+	0xd5, 0x36, 0x75, 0xd7, 0xd1, 0x8d, 0x5d, 0x7d, 0xf9, 0xd9, 0xc6, 0x8f, 0x6e, 0x87, 0x99, 0x24,
+	0x82, 0x07, 0x61, 0x0f, 0x34, 0x9d, 0xeb, 0x66, 0xa0, 0x96, 0x68, 0x8f, 0x30, 0xba, 0x4d, 0x89,
+	0x9e, 0x71, 0xbc, 0x11, 0x68, 0xaa, 0xac, 0x66, 0x2c, 0x91, 0x9a, 0x22, 0xd9, 0x6d, 0x05, 0xc8,
+	0x0b, 0x64, 0x13, 0x20, 0xcb, 0xec, 0xf3, 0x00, 0x49, 0x1e, 0x24, 0x40, 0x5e, 0x22, 0x0f, 0x91,
+	0x4d, 0x70, 0x8a, 0x17, 0x91, 0xb2, 0xba, 0xdd, 0xbb, 0x3a, 0xdf, 0x39, 0x55, 0x3c, 0xf7, 0x3a,
+	0x45, 0x68, 0x71, 0x66, 0x2e, 0xe6, 0xef, 0x5d, 0x7e, 0xab, 0x6d, 0xb8, 0xeb, 0xbb, 0xc7, 0x2f,
+	0x96, 0xae, 0xbb, 0x5c, 0xb1, 0x57, 0x82, 0xba, 0x0e, 0x6e, 0x5e, 0x2d, 0x02, 0x6e, 0xfa, 0xb6,
+	0xeb, 0x44, 0xfc, 0x97, 0xfb, 0x7c, 0xdf, 0x5e, 0x33, 0xcf, 0x37, 0xd7, 0x9b, 0x50, 0x40, 0xfd,
+	0x77, 0x09, 0x0a, 0xdf, 0xbb, 0xfc, 0x96, 0x10, 0x28, 0xdc, 0xd8, 0x2b, 0xa6, 0x48, 0x27, 0x52,
+	0xbb, 0x4a, 0xc5, 0x9a, 0xb4, 0xa1, 0xe5, 0x9b, 0x7c, 0xc9, 0xfc, 0x59, 0x70, 0xed, 0xf9, 0xdc,
+	0x76, 0x96, 0x4a, 0x4e, 0xb0, 0xf7, 0x61, 0xf2, 0x05, 0x14, 0x3d, 0xdb, 0xb1, 0x98, 0x92, 0x3f,
+	0x91, 0xda, 0xb5, 0xce, 0xb1, 0x16, 0x7e, 0x57, 0x8b, 0xbf, 0xab, 0x19, 0xf1, 0x77, 0x69, 0x28,
+	0x88, 0x3b, 0x02, 0xc7, 0xb7, 0x57, 0x4a, 0xe1, 0xe1, 0x1d, 0x42, 0x90, 0x3c, 0x83, 0xd2, 0x75,
+	0x60, 0xdd, 0x32, 0x5f, 0x29, 0x0a, 0x25, 0x22, 0x8a, 0x3c, 0x81, 0x22, 0x6a, 0xeb, 0x29, 0xa5,
+	0x93, 0x7c, 0xbb, 0x4a, 0x43, 0x82, 0x68, 0x50, 0xb3, 0xdc, 0xf5, 0x86, 0x33, 0xcf, 0xb3, 0x5d,
+	0x47, 0x29, 0x9f, 0x48, 0xed, 0x66, 0xa7, 0xae, 0xf5, 0x76, 0x18, 0x4d, 0x0b, 0x90, 0x9f, 0x41,
+	0xf9, 0xc6, 0x5e, 0xf9, 0x8c, 0x7b, 0x4a, 0x45, 0x68, 0xd4, 0xd0, 0xce, 0x6c, 0xb6, 0x5a, 0x9c,
+	0x85, 0x20, 0x8d, 0xb9, 0xf8, 0xb9, 0x1f, 0x02, 0xc6, 0xb7, 0x4a, 0x55, 0x68, 0x11, 0x12, 0xe4,
+	0x05, 0xc0, 0x86, 0xbb, 0xbf, 0x67, 0x16, 0x3a, 0x5f, 0x01, 0xa1, 0x49, 0x0a, 0x21, 0xbf, 0x82,
+	0x66, 0xe2, 0x7a, 0x71, 0xae, 0x52, 0x13, 0x1a, 0xb5, 0x34, 0x23, 0x03, 0xd3, 0x3d, 0x31, 0xf2,
+	0x19, 0x34, 0x12, 0x64, 0x6a, 0xfa, 0x6f, 0x95, 0xba, 0xf8, 0x6c, 0x16, 0x44, 0x6b, 0x19, 0xe7,
+	0x2e, 0x9f, 0xba, 0x2b, 0xdb, 0xda, 0x2a, 0x8d, 0xc8, 0x5a, 0x7d, 0x87, 0xd1, 0xb4, 0x00, 0x39,
+	0x86, 0xca, 0xda, 0xbc, 0x1b, 0xda, 0x0e, 0xf3, 0x94, 0xe6, 0x89, 0xd4, 0xce, 0xd3, 0x84, 0x8e,
+	0x78, 0x6f, 0xb6, 0x3e, 0xf3, 0x94, 0x56, 0xc2, 0x13, 0x34, 0xf9, 0x09, 0x54, 0x3c, 0x73, 0xbd,
+	0x59, 0x61, 0x2a, 0xc8, 0xc2, 0x4d, 0x55, 0x6d, 0x16, 0x01, 0x34, 0x61, 0x91, 0x97, 0x50, 0xb2,
+	0x02, 0xee, 0xb9, 0x5c, 0x79, 0x24, 0x84, 0xca, 0x5a, 0x4f, 0x90, 0x34, 0x82, 0x89, 0x02, 0x65,
+	0x97, 0x2f, 0x18, 0x67, 0x0b, 0x85, 0x9c, 0x48, 0xed, 0x0a, 0x8d, 0x49, 0xf2, 0x15, 0x34, 0x38,
+	0x13, 0xc4, 0xf7, 0xb6, 0xb3, 0x70, 0xdf, 0x2b, 0x8f, 0xc5, 0x09, 0xcf, 0xef, 0xe5, 0x47, 0x3f,
+	0xca, 0x74, 0x9a, 0x95, 0x27, 0xaf, 0xa1, 0xb1, 0x60, 0x8b, 0x60, 0xb3, 0xb2, 0x2d, 0xc1, 0x57,
+	0x9e, 0x08, 0x67, 0x34, 0xb5, 0x7e, 0x1a, 0xa5, 0x59, 0x21, 0xf2, 0x0d, 0x3c, 0xce, 0x00, 0xd1,
+	0xc7, 0x9f, 0x3e, 0xf4, 0xf1, 0x43, 0xbb, 0xd4, 0x4b, 0x28, 0x85, 0xf6, 0x62, 0xce, 0x7a, 0x6e,
+	0xc0, 0xad, 0xb8, 0xae, 0x22, 0x0a, 0x71, 0xf7, 0xe6, 0xc6, 0x63, 0xbe, 0x28, 0xa8, 0x3c, 0x8d,
+	0x28, 0x4c, 0xa3, 0x95, 0xed, 0xb0, 0x71, 0xb0, 0xbe, 0x66, 0x5c, 0x14, 0x53, 0x9e, 0xa6, 0x10,
+	0xf5, 0x02, 0x2a, 0xb1, 0xbb, 0xc9, 0x8f, 0xa0, 0xb0, 0x76, 0x17, 0xe1, 0xc9, 0xcd, 0x4e, 0x23,
+	0x89, 0xc3, 0xc8, 0x5d, 0x30, 0x2a, 0x58, 0x58, 0xd4, 0xdc, 0xf4, 0x99, 0xf8, 0x88, 0x44, 0xc5,
+	0x1a, 0x31, 0x8f, 0xb1, 0x45, 0x74, 0xb8, 0x58, 0xab, 0x3d, 0xa8, 0xcd, 0x44, 0x21, 0x8f, 0x4c,
+	0xdf, 0x7a, 0x4b, 0x5e, 0x40, 0xc1, 0xdf, 0x6e, 0xe2, 0x93, 0x41, 0x13, 0xa8, 0xb1, 0xdd, 0x30,
+	0x2a, 0x70, 0x2c, 0x81, 0x77, 0xe6, 0x2a, 0x60, 0x51, 0x37, 0x08, 0x09, 0xf5, 0x15, 0x54, 0x7b,
+	0xf8, 0x69, 0xd3, 0x59, 0x32, 0x22, 0x43, 0x7e, 0x6d, 0x3b, 0xe2, 0x84, 0x22, 0xc5, 0xa5, 0x40,
+	0xcc, 0x3b, 0x25, 0x17, 0x21, 0xe6, 0x9d, 0xfa, 0x16, 0xea, 0x43, 0xd3, 0x67, 0x8e, 0xb5, 0x0d,
+	0xf7, 0x7c, 0xbe, 0xdb, 0xf3, 0x51, 0x9f, 0x8b, 0xe3, 0x3e, 0xdf, 0x1d, 0xf7, 0x80, 0xb0, 0x79,
+	0xa7, 0xfe, 0xab, 0x00, 0xf5, 0x74, 0x35, 0x93, 0x13, 0x28, 0xbc, 0x63, 0xfc, 0x5a, 0x91, 0x4e,
+	0xf2, 0xed, 0x5a, 0xa7, 0xae, 0xa5, 0xac, 0xa7, 0x82, 0x43, 0xda, 0x50, 0x09, 0x3c, 0xc6, 0x1d,
+	0x73, 0x8d, 0x66, 0xde, 0x97, 0x4a, 0xb8, 0xe4, 0x14, 0xaa, 0xb8, 0x3e, 0xe7, 0x6e, 0xb0, 0x51,
+	0xf2, 0x07, 0x44, 0x77, 0x6c, 0x3c, 0x95, 0xb3, 0x28, 0x23, 0x0a, 0x87, 0x4e, 0x8d, 0xb9, 0x58,
+	0xd1, 0x5e, 0x70, 0x9d, 0x08, 0x17, 0x0f, 0x08, 0xa7, 0x05, 0x50, 0x0b, 0xd4, 0xc6, 0xdb, 0x98,
+	0x16, 0x53, 0x4a, 0x07, 0xa4, 0x77, 0x6c, 0xb4, 0x5e, 0xd8, 0x55, 0x3e, 0x64, 0xbd, 0xb0, 0xa9,
+	0x0d, 0x15, 0x73, 0x63, 0x87, 0x26, 0x55, 0x0e, 0xe9, 0x19, 0x73, 0x89, 0x0a, 0x45, 0xcf, 0x37,
+	0x97, 0x4c, 0xa9, 0x1e, 0x10, 0x0b, 0x59, 0x28, 0xb3, 0x62, 0xef, 0xd8, 0x4a, 0x81, 0x43, 0x32,
+	0x82, 0x45, 0x34, 0xa8, 0x73, 0xe6, 0x6d, 0x5c, 0xc7, 0x63, 0x98, 0x45, 0x4a, 0x4d, 0x88, 0x82,
+	0x96, 0xa4, 0x14, 0xcd, 0xf0, 0x63, 0xaf, 0x77, 0x97, 0xcc, 0xf1, 0x95, 0xfa, 0x87, 0xbc, 0x2e,
+	0xd8, 0x68, 0x4d, 0xe8, 0xa5, 0xc1, 0x54, 0x69, 0x1c, 0xb2, 0x26, 0xe6, 0xe2, 0x2d, 0xb0, 0x0a,
+	0x53, 0x52, 0x69, 0x0a, 0xc1, 0x86, 0x96, 0x4e, 0x51, 0x1a, 0x73, 0xd5, 0xff, 0x48, 0x50, 0x1e,
+	0xba, 0x4b, 0xec, 0x98, 0xe4, 0xd7, 0x50, 0x4d, 0xba, 0xb1, 0x22, 0x3d, 0x78, 0x9d, 0xed, 0x84,
+	0xb1, 0x90, 0x98, 0xe3, 0xf3, 0x6d, 0x5c, 0x48, 0x82, 0x48, 0x35, 0x8d, 0x7c, 0xa6, 0x69, 0x64,
+	0xef, 0x98, 0x82, 0xe0, 0xa5, 0x10, 0xf2, 0xe5, 0x4e, 0xf9, 0xe2, 0x43, 0x65, 0x11, 0x4b, 0x62,
+	0xab, 0x16, 0x41, 0xc2, 0xeb, 0x33, 0x6c, 0xd5, 0x33, 0x41, 0xd2, 0x08, 0x56, 0xff, 0x94, 0x87,
+	0x52, 0x08, 0x91, 0x3e, 0x0e, 0x20, 0x3f, 0x04, 0xcc, 0xf3, 0x29, 0xb3, 0x98, 0xfd, 0x8e, 0x2d,
+	0x3e, 0xc1, 0xdc, 0xfd, 0x2d, 0xe1, 0x29, 0x61, 0x24, 0x67, 0xbe, 0xc9, 0x7d, 0xb6, 0x50, 0x72,
+	0x9f, 0x72, 0x4a, 0x66, 0x0b, 0x39, 0x03, 0x79, 0x97, 0x0f, 0xeb, 0xcd, 0x8a, 0xf9, 0x9f, 0x32,
+	0x7c, 0xdc, 0xdb, 0x83, 0x73, 0xc8, 0xc6, 0x74, 0x6c, 0xeb, 0x53, 0xe6, 0x10, 0x21, 0x48, 0x7a,
+	0xd0, 0xc2, 0x08, 0x1a, 0xee, 0x99, 0xcd, 0x3d, 0x1f, 0xef, 0xc5, 0x87, 0xdd, 0xbd, 0xbf, 0x83,
+	0xfc, 0x02, 0x2a, 0xf1, 0xa8, 0xa6, 0x94, 0x1e, 0xda, 0x9d, 0x88, 0xaa, 0x7f, 0x96, 0xa0, 0x31,
+	0x32, 0x57, 0x37, 0x2e, 0x5f, 0xb3, 0x85, 0x48, 0xbe, 0x0f, 0xdd, 0x30, 0xd9, 0x9b, 0x24, 0xb7,
+	0x7f, 0x93, 0xe0, 0x35, 0x80, 0x54, 0x94, 0x62, 0x62, 0x2d, 0xd2, 0x91, 0x73, 0x97, 0x47, 0xb9,
+	0x15, 0x12, 0xe4, 0xff, 0xa1, 0xea, 0xf3, 0xc0, 0xb1, 0x4c, 0x8c, 0x54, 0x51, 0xdc, 0xd6, 0x3b,
+	0x40, 0xfd, 0x6f, 0x0e, 0x6a, 0x38, 0x40, 0xce, 0x82, 0xf5, 0xda, 0xe4, 0x5b, 0xf2, 0x53, 0x68,
+	0xae, 0xd3, 0x0a, 0x7a, 0x42, 0xaf, 0x3c, 0xdd, 0x43, 0x51, 0x2e, 0x39, 0x24, 0x94, 0x0b, 0x75,
+	0xdc, 0x43, 0x89, 0x0a, 0x75, 0xef, 0xd6, 0xde, 0x6c, 0x62, 0xa9, 0xf0, 0xda, 0xca, 0x60, 0xa8,
+	0xe1, 0x35, 0x8e, 0x27, 0x94, 0x99, 0x0b, 0xa1, 0x7b, 0x9e, 0xee, 0x00, 0x3c, 0x01, 0xad, 0xf3,
+	0x66, 0x96, 0xe9, 0x38, 0x91, 0x09, 0x79, 0x9a, 0xc1, 0x12, 0x19, 0xd1, 0x0f, 0xd8, 0x42, 0x29,
+	0xa5, 0x64, 0x22, 0x0c, 0x3d, 0x66, 0x61, 0x67, 0x2a, 0x8b, 0x1b, 0x4c, 0xac, 0x77, 0x1e, 0xab,
+	0xa4, 0x3d, 0x26, 0x4e, 0x5b, 0xdb, 0x3e, 0x65, 0xa6, 0x38, 0xad, 0x2a, 0x9c, 0x96, 0xc1, 0x50,
+	0x67, 0x2c, 0xc1, 0xd0, 0x28, 0x08, 0x75, 0x4e, 0x00, 0xf4, 0x4e, 0x3c, 0x56, 0x44, 0x22, 0xb5,
+	0xd0, 0x3b, 0x59, 0x54, 0xfd, 0xa7, 0x04, 0x80, 0xde, 0xa7, 0xcc, 0x0b, 0x56, 0x3e, 0xf9, 0x0c,
+	0x2a, 0x2b, 0x77, 0x19, 0xbb, 0x1d, 0xfb, 0x57, 0x45, 0x8b, 0xba, 0x14, 0x4d, 0x38, 0xe4, 0x97,
+	0xf7, 0x42, 0x14, 0x5e, 0x70, 0x4d, 0x2d, 0x93, 0x5a, 0x07, 0x42, 0x56, 0xf6, 0xc2, 0x28, 0x47,
+	0x95, 0x56, 0xd7, 0x52, 0x91, 0xa7, 0x31, 0x33, 0x35, 0xfd, 0x15, 0x0e, 0x4e, 0x7f, 0xea, 0x77,
+	0x20, 0x0f, 0x6d, 0xcf, 0x3f, 0xc3, 0x41, 0x9d, 0x86, 0xdd, 0x21, 0x35, 0xdd, 0x4b, 0x99, 0xe9,
+	0xfe, 0x19, 0x94, 0x36, 0x9c, 0xdd, 0xd8, 0x77, 0x51, 0x8f, 0x8c, 0x28, 0x8c, 0xc6, 0x72, 0xe5,
+	0x5e, 0xc7, 0xf9, 0x8b, 0x6b, 0xf5, 0x1f, 0x12, 0x54, 0xf0, 0xd0, 0x81, 0x73, 0xe3, 0xa2, 0x80,
+	0xb8, 0xe4, 0xa2, 0x07, 0x0d, 0xae, 0x11, 0xf3, 0xec, 0x3f, 0xb0, 0x28, 0xd5, 0xc4, 0x1a, 0x0b,
+	0x65, 0xc9, 0x1c, 0x16, 0xd5, 0x62, 0x34, 0x72, 0xed, 0x10, 0x7c, 0x04, 0x59, 0xae, 0xe3, 0x33,
+	0xc7, 0xd7, 0x1d, 0xcb, 0x5d, 0xe0, 0xe4, 0x1b, 0x96, 0xc7, 0x3e, 0x4c, 0x5e, 0x43, 0x39, 0xd8,
+	0x2c, 0x92, 0x32, 0xf9, 0x78, 0x33, 0x89, 0x45, 0xd5, 0x0e, 0xb4, 0x52, 0xce, 0x10, 0x61, 0x7c,
+	0x19, 0xbf, 0x68, 0xc2, 0x18, 0x56, 0xb5, 0xd8, 0xa8, 0xe8, 0x71, 0xa3, 0x2e, 0x01, 0xba, 0xcb,
+	0x25, 0x67, 0x4b, 0xd3, 0x77, 0x39, 0xf9, 0x71, 0x66, 0x5c, 0x6b, 0x69, 0x3b, 0x56, 0x76, 0x66,
+	0xbb, 0x11, 0xef, 0x8e, 0xe8, 0xaa, 0x11, 0x84, 0xb8, 0x52, 0x18, 0xb7, 0x18, 0x3e, 0xb0, 0xc2,
+	0x5e, 0x20, 0xd1, 0x14, 0xa2, 0xfe, 0x5d, 0x02, 0x39, 0x3e, 0x8e, 0xc5, 0xa1, 0x7a, 0x0e, 0x05,
+	0x7c, 0x82, 0x46, 0xbd, 0xbf, 0x28, 0x92, 0x80, 0x0a, 0x08, 0xe7, 0xfa, 0x25, 0x8e, 0x05, 0x6f,
+	0xb6, 0x22, 0xa7, 0xaa, 0x34, 0x26, 0xc9, 0x6f, 0x00, 0xb0, 0x07, 0xbe, 0x09, 0x63, 0x9c, 0x7f,
+	0xa8, 0xe5, 0xa5, 0x84, 0xc9, 0xcf, 0xa1, 0x66, 0x26, 0x26, 0x79, 0xd1, 0xdc, 0x54, 0x4b, 0x99,
+	0x49, 0xd3, 0x7c, 0xd5, 0x81, 0xfa, 0x4e, 0x65, 0xf7, 0x3d, 0xe9, 0x64, 0x32, 0xeb, 0xe3, 0x51,
+	0x89, 0xb3, 0x8e, 0x40, 0xe1, 0x96, 0x6d, 0xbd, 0xc8, 0x08, 0xb1, 0xc6, 0x4c, 0x14, 0x83, 0xae,
+	0x27, 0x86, 0x3c, 0x89, 0x46, 0x94, 0xfa, 0x57, 0x09, 0x5a, 0x29, 0x1f, 0x89, 0x08, 0x2a, 0x50,
+	0xb6, 0xdc, 0x55, 0xb0, 0x76, 0xc2, 0x18, 0x56, 0x69, 0x4c, 0xe2, 0xd4, 0xce, 0xdd, 0xf7, 0x71,
+	0xc9, 0x35, 0xb4, 0xb4, 0xaa, 0x54, 0xb0, 0x0e, 0xb4, 0xd0, 0xfc, 0xc1, 0x16, 0xba, 0xdf, 0x66,
+	0x0a, 0xf7, 0xdb, 0xcc, 0xa9, 0x05, 0x8d, 0xcc, 0xbb, 0x87, 0x3c, 0x03, 0xd2, 0xd7, 0xfb, 0x17,
+	0xd3, 0xe1, 0xa0, 0xd7, 0x35, 0x06, 0x93, 0xf1, 0x7c, 0x3c, 0x19, 0xeb, 0xf2, 0x11, 0x79, 0x01,
+	0xc7, 0x59, 0x7c, 0xd8, 0x35, 0xf4, 0x99, 0x31, 0x9f, 0x19, 0xdd, 0x73, 0x5d, 0x96, 0xc8, 0x31,
+	0x3c, 0xcb, 0xf2, 0x7b, 0x93, 0xd1, 0x9b, 0xc1, 0x58, 0xef, 0xcb, 0xb9, 0xd3, 0xdf, 0x42, 0x3d,
+	0xfd, 0xf8, 0x20, 0x8f, 0xa1, 0x35, 0xeb, 0x8e, 0xa6, 0xc3, 0xc1, 0xf8, 0x7c, 0x4e, 0xbb, 0xe3,
+	0xfe, 0x64, 0x24, 0x1f, 0x91, 0xa7, 0xf0, 0x28, 0x01, 0xbb, 0x17, 0xfd, 0x81, 0x31, 0x1f, 0xf4,
+	0x65, 0xe9, 0xd4, 0x80, 0x5a, 0xea, 0x95, 0x8a, 0x52, 0x3a, 0xa5, 0x13, 0x3a, 0x9f, 0x4e, 0x86,
+	0x83, 0xde, 0xef, 0xe6, 0xb3, 0x6f, 0x06, 0x53, 0xf9, 0xe8, 0x3e, 0x6c, 0x4c, 0xa6, 0xb2, 0x44,
+	0xfe, 0x0f, 0x1e, 0x67, 0x60, 0xaa, 0x4f, 0x27, 0xd4, 0x90, 0x73, 0xa7, 0xdf, 0x42, 0x33, 0xfb,
+	0xae, 0x46, 0xbb, 0x8d, 0xc1, 0x48, 0x9f, 0x19, 0xdd, 0xd1, 0x74, 0x4e, 0xf5, 0x9e, 0x3e, 0xf8,
+	0x4e, 0xef, 0xcb, 0x47, 0xa8, 0xeb, 0x0e, 0x8f, 0x8d, 0x25, 0xd0, 0xdc, 0x81, 0xd3, 0xae, 0xf1,
+	0xb5, 0x9c, 0x3b, 0xfd, 0x0a, 0xaa, 0xc9, 0x3b, 0x88, 0xb4, 0xa0, 0x36, 0xea, 0x1a, 0xbd, 0xaf,
+	0xe7, 0xfa, 0x65, 0xb7, 0x67, 0xc8, 0x47, 0x44, 0x86, 0x7a, 0x08, 0x4c, 0xa9, 0x7e, 0x36, 0xb8,
+	0x94, 0xa5, 0x9d, 0x08, 0xd5, 0xcf, 0xf5, 0x4b, 0x39, 0x77, 0xfa, 0x37, 0x09, 0x6a, 0xa9, 0xdf,
+	0x0f, 0xe4, 0x09, 0xc8, 0xbd, 0xc9, 0x68, 0x4a, 0xf5, 0xd9, 0x0c, 0xfd, 0xd9, 0xbd, 0x30, 0x26,
+	0xf2, 0xd1, 0x3e, 0x2a, 0xa2, 0x23, 0xed, 0xa3, 0xe7, 0x57, 0x83, 0xa9, 0x9c, 0xdb, 0x47, 0xaf,
+	0x66, 0x46, 0x5f, 0xce, 0xa3, 0xaf, 0xd2, 0xe8, 0x9b, 0xab, 0xc1, 0xb4, 0x23, 0x17, 0xd0, 0xa6,
+	0x34, 0x7c, 0x79, 0x25, 0x17, 0xd1, 0xf8, 0x34, 0x36, 0xbc, 0x7a, 0x2d, 0x97, 0x4e, 0xff, 0x08,
+	0xcd, 0x6c, 0x07, 0xc1, 0xef, 0x74, 0xcf, 0xcf, 0xa9, 0x7e, 0xde, 0x35, 0x26, 0x74, 0xde, 0x9b,
+	0x5c, 0x8c, 0xd1, 0x64, 0x02, 0xcd, 0x14, 0x3a, 0xbb, 0x18, 0xc9, 0xd2, 0x1e, 0x36, 0x1a, 0x8c,
+	0xe5, 0xdc, 0x3e, 0xd6, 0xbd, 0x94, 0xf3, 0xe4, 0x39, 0x3c, 0x4d, 0x61, 0x53, 0x9d, 0xf6, 0xf4,
+	0xb1, 0x31, 0x18, 0xea, 0x72, 0xa1, 0xf3, 0x17, 0x09, 0x4a, 0xd8, 0x51, 0x18, 0x27, 0x27, 0x50,
+	0xea, 0xbb, 0xb8, 0x26, 0x61, 0x93, 0x39, 0xae, 0x69, 0xbb, 0xcb, 0x4e, 0x3d, 0xfa, 0x42, 0x22,
+	0x1d, 0xa8, 0x26, 0xcd, 0x93, 0x3c, 0xd2, 0xf6, 0x6f, 0x95, 0x63, 0x59, 0xdb, 0xeb, 0xad, 0xea,
+	0x11, 0xee, 0x49, 0x8a, 0x8e, 0x3c, 0xd2, 0xf6, 0xdb, 0xdb, 0xb1, 0xac, 0xed, 0x55, 0xb3, 0x7a,
+	0xd4, 0xd1, 0x30, 0x74, 0x2e, 0x5f, 0xd8, 0x8e, 0xe8, 0xb8, 0x2f, 0xa1, 0xf8, 0xad, 0xf8, 0xed,
+	0xf3, 0x01, 0xbd, 0xae, 0x4b, 0xa2, 0xb7, 0x7c, 0xf9, 0xbf, 0x01, 0x00, 0xa9, 0x08, 0xa3, 0x01,
+	0xb1, 0x13, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -217,6 +1913,8 @@ const _ = grpc.SupportPackageIsVersion4
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
 type WorkerClient interface {
 	DoWork(ctx context.Context, in *Work, opts ...grpc.CallOption) (Worker_DoWorkClient, error)
+	ListFiles(ctx context.Context, in *ListFilesRequest, opts ...grpc.CallOption) (*ListFilesResult, error)
+	Aggregate(ctx context.Context, in *AggregateRequest, opts ...grpc.CallOption) (*AggregateResult, error)
 }
 
 type workerClient struct {
@@ -259,9 +1957,29 @@ func (x *workerDoWorkClient) Recv() (*WorkResult, error) {
 	return m, nil
 }
 
+func (c *workerClient) ListFiles(ctx context.Context, in *ListFilesRequest, opts ...grpc.CallOption) (*ListFilesResult, error) {
+	out := new(ListFilesResult)
+	err := c.cc.Invoke(ctx, "/Worker/ListFiles", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *workerClient) Aggregate(ctx context.Context, in *AggregateRequest, opts ...grpc.CallOption) (*AggregateResult, error) {
+	out := new(AggregateResult)
+	err := c.cc.Invoke(ctx, "/Worker/Aggregate", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // WorkerServer is the server API for Worker service.
 type WorkerServer interface {
 	DoWork(*Work, Worker_DoWorkServer) error
+	ListFiles(context.Context, *ListFilesRequest) (*ListFilesResult, error)
+	Aggregate(context.Context, *AggregateRequest) (*AggregateResult, error)
 }
 
 // UnimplementedWorkerServer can be embedded to have forward compatible implementations.
@@ -271,6 +1989,12 @@ type UnimplementedWorkerServer struct {
 func (*UnimplementedWorkerServer) DoWork(req *Work, srv Worker_DoWorkServer) error {
 	return status.Errorf(codes.Unimplemented, "method DoWork not implemented")
 }
+func (*UnimplementedWorkerServer) ListFiles(ctx context.Context, req *ListFilesRequest) (*ListFilesResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListFiles not implemented")
+}
+func (*UnimplementedWorkerServer) Aggregate(ctx context.Context, req *AggregateRequest) (*AggregateResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Aggregate not implemented")
+}
 
 func RegisterWorkerServer(s *grpc.Server, srv WorkerServer) {
 	s.RegisterService(&_Worker_serviceDesc, srv)
@@ -297,10 +2021,55 @@ func (x *workerDoWorkServer) Send(m *WorkResult) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _Worker_ListFiles_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListFilesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WorkerServer).ListFiles(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Worker/ListFiles",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WorkerServer).ListFiles(ctx, req.(*ListFilesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Worker_Aggregate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AggregateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WorkerServer).Aggregate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Worker/Aggregate",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WorkerServer).Aggregate(ctx, req.(*AggregateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Worker_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "Worker",
 	HandlerType: (*WorkerServer)(nil),
-	Methods:     []grpc.MethodDesc{},
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListFiles",
+			Handler:    _Worker_ListFiles_Handler,
+		},
+		{
+			MethodName: "Aggregate",
+			Handler:    _Worker_Aggregate_Handler,
+		},
+	},
 	Streams: []grpc.StreamDesc{
 		{
 			StreamName:    "DoWork",
@@ -310,3 +2079,110 @@ var _Worker_serviceDesc = grpc.ServiceDesc{
 	},
 	Metadata: "read_work.proto",
 }
+
+// CoordinatorClient is the client API for Coordinator service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type CoordinatorClient interface {
+	// Query reads each file of the Work on a worker, retrying failed files
+	// on other workers, and merges their results into one stream that ends
+	// with a summary of all files. Cursors, ordered and deduplicated results
+	// are not supported.
+	Query(ctx context.Context, in *Work, opts ...grpc.CallOption) (Coordinator_QueryClient, error)
+}
+
+type coordinatorClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewCoordinatorClient(cc *grpc.ClientConn) CoordinatorClient {
+	return &coordinatorClient{cc}
+}
+
+func (c *coordinatorClient) Query(ctx context.Context, in *Work, opts ...grpc.CallOption) (Coordinator_QueryClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Coordinator_serviceDesc.Streams[0], "/Coordinator/Query", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &coordinatorQueryClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Coordinator_QueryClient interface {
+	Recv() (*WorkResult, error)
+	grpc.ClientStream
+}
+
+type coordinatorQueryClient struct {
+	grpc.ClientStream
+}
+
+func (x *coordinatorQueryClient) Recv() (*WorkResult, error) {
+	m := new(WorkResult)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// CoordinatorServer is the server API for Coordinator service.
+type CoordinatorServer interface {
+	// Query reads each file of the Work on a worker, retrying failed files
+	// on other workers, and merges their results into one stream that ends
+	// with a summary of all files. Cursors, ordered and deduplicated results
+	// are not supported.
+	Query(*Work, Coordinator_QueryServer) error
+}
+
+// UnimplementedCoordinatorServer can be embedded to have forward compatible implementations.
+type UnimplementedCoordinatorServer struct {
+}
+
+func (*UnimplementedCoordinatorServer) Query(req *Work, srv Coordinator_QueryServer) error {
+	return status.Errorf(codes.Unimplemented, "method Query not implemented")
+}
+
+func RegisterCoordinatorServer(s *grpc.Server, srv CoordinatorServer) {
+	s.RegisterService(&_Coordinator_serviceDesc, srv)
+}
+
+func _Coordinator_Query_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Work)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CoordinatorServer).Query(m, &coordinatorQueryServer{stream})
+}
+
+type Coordinator_QueryServer interface {
+	Send(*WorkResult) error
+	grpc.ServerStream
+}
+
+type coordinatorQueryServer struct {
+	grpc.ServerStream
+}
+
+func (x *coordinatorQueryServer) Send(m *WorkResult) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _Coordinator_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "Coordinator",
+	HandlerType: (*CoordinatorServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Query",
+			Handler:       _Coordinator_Query_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "read_work.proto",
+}
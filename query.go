@@ -0,0 +1,344 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// parseQuery compiles a boolean query over audit event fields, e.g.
+//
+//	verb in (create,update) AND objectRef.resource = "pods" AND NOT user.username ~ "^system:node:"
+//
+// Comparisons are =, !=, ~ (regex), !~, ^= (prefix), and <, <=, >, >= for
+// numbers; they combine with AND, OR, NOT and parentheses. Fields with
+// several values, like user.groups, match when any value does.
+func parseQuery(query string) (eventPredicate, error) {
+	tokens, err := tokenizeQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	parser := &queryParser{tokens: tokens}
+	predicate, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if token := parser.peek(); token.kind != tokenEnd {
+		return nil, token.errorf("unexpected %s", token)
+	}
+	return predicate, nil
+}
+
+// querySyntaxError points at the position in the query that failed to parse.
+type querySyntaxError struct {
+	position int
+	message  string
+}
+
+func (e *querySyntaxError) Error() string {
+	return fmt.Sprintf("query syntax error at position %d: %s", e.position, e.message)
+}
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenWord
+	tokenString
+	tokenOperator
+	tokenLeftParen
+	tokenRightParen
+	tokenComma
+)
+
+type queryToken struct {
+	kind  tokenKind
+	value string
+	// position is the 1-based offset of the token in the query.
+	position int
+}
+
+func (t queryToken) String() string {
+	switch t.kind {
+	case tokenEnd:
+		return "end of query"
+	case tokenString:
+		return strconv.Quote(t.value)
+	}
+	return fmt.Sprintf("%q", t.value)
+}
+
+func (t queryToken) errorf(format string, args ...interface{}) error {
+	return &querySyntaxError{position: t.position, message: fmt.Sprintf(format, args...)}
+}
+
+func (t queryToken) isKeyword(keyword string) bool {
+	return t.kind == tokenWord && strings.EqualFold(t.value, keyword)
+}
+
+var queryOperators = []string{"!=", "!~", "^=", "<=", ">=", "==", "=", "~", "<", ">"}
+
+const querySeparators = " \t\r\n()\",=!~^<>"
+
+func tokenizeQuery(query string) ([]queryToken, error) {
+	var tokens []queryToken
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '(':
+			tokens = append(tokens, queryToken{kind: tokenLeftParen, value: "(", position: i + 1})
+			i++
+		case c == ')':
+			tokens = append(tokens, queryToken{kind: tokenRightParen, value: ")", position: i + 1})
+			i++
+		case c == ',':
+			tokens = append(tokens, queryToken{kind: tokenComma, value: ",", position: i + 1})
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(query) && query[end] != '"' {
+				if query[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(query) {
+				return nil, &querySyntaxError{position: i + 1, message: "unterminated string"}
+			}
+			value, err := strconv.Unquote(query[i : end+1])
+			if err != nil {
+				return nil, &querySyntaxError{position: i + 1, message: "bad string: " + err.Error()}
+			}
+			tokens = append(tokens, queryToken{kind: tokenString, value: value, position: i + 1})
+			i = end + 1
+		case strings.IndexByte(querySeparators, c) != -1:
+			operator := ""
+			for _, candidate := range queryOperators {
+				if strings.HasPrefix(query[i:], candidate) {
+					operator = candidate
+					break
+				}
+			}
+			if operator == "" {
+				return nil, &querySyntaxError{position: i + 1, message: fmt.Sprintf("unexpected character %q", c)}
+			}
+			tokens = append(tokens, queryToken{kind: tokenOperator, value: operator, position: i + 1})
+			i += len(operator)
+		default:
+			end := i
+			for end < len(query) && strings.IndexByte(querySeparators, query[end]) == -1 {
+				end++
+			}
+			tokens = append(tokens, queryToken{kind: tokenWord, value: query[i:end], position: i + 1})
+			i = end
+		}
+	}
+	return append(tokens, queryToken{kind: tokenEnd, position: len(query) + 1}), nil
+}
+
+// maxQueryDepth limits how deeply parentheses and NOT nest, as both are
+// parsed recursively.
+const maxQueryDepth = 100
+
+type queryParser struct {
+	tokens []queryToken
+	next   int
+	depth  int
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.next]
+}
+
+func (p *queryParser) advance() queryToken {
+	token := p.tokens[p.next]
+	if token.kind != tokenEnd {
+		p.next++
+	}
+	return token
+}
+
+// parseOr and parseAnd collect the operands of a chain into a single
+// predicate, so long chains are not evaluated recursively either.
+func (p *queryParser) parseOr() (eventPredicate, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	operands := []eventPredicate{left}
+	for p.peek().isKeyword("OR") {
+		p.advance()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, right)
+	}
+	if len(operands) == 1 {
+		return left, nil
+	}
+	return anyOf(operands...), nil
+}
+
+func (p *queryParser) parseAnd() (eventPredicate, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	operands := []eventPredicate{left}
+	for p.peek().isKeyword("AND") {
+		p.advance()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, right)
+	}
+	return allOf(operands...), nil
+}
+
+func (p *queryParser) parseUnary() (eventPredicate, error) {
+	token := p.peek()
+	if token.isKeyword("NOT") || token.kind == tokenLeftParen {
+		if p.depth == maxQueryDepth {
+			return nil, token.errorf("nested more than %d levels deep", maxQueryDepth)
+		}
+		p.depth++
+		defer func() { p.depth-- }()
+	}
+	switch {
+	case token.isKeyword("NOT"):
+		p.advance()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(e *auditEvent) bool { return !operand(e) }, nil
+	case token.kind == tokenLeftParen:
+		p.advance()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.advance(); closing.kind != tokenRightParen {
+			return nil, closing.errorf("expected \")\", got %s", closing)
+		}
+		return inner, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *queryParser) parseComparison() (eventPredicate, error) {
+	fieldToken := p.advance()
+	if fieldToken.kind != tokenWord || isQueryKeyword(fieldToken) {
+		return nil, fieldToken.errorf("expected field name, got %s", fieldToken)
+	}
+	values, ok := resolveAuditField(fieldToken.value)
+	if !ok {
+		return nil, fieldToken.errorf("unknown field %s", fieldToken.value)
+	}
+
+	operator := p.advance()
+	if operator.isKeyword("IN") {
+		options, err := p.parseValueList()
+		if err != nil {
+			return nil, err
+		}
+		return anyValue(values, func(value string) bool {
+			for _, option := range options {
+				if value == option {
+					return true
+				}
+			}
+			return false
+		}), nil
+	}
+	if operator.kind != tokenOperator {
+		return nil, operator.errorf("expected comparison operator, got %s", operator)
+	}
+
+	operandToken := p.advance()
+	if operandToken.kind != tokenString && (operandToken.kind != tokenWord || isQueryKeyword(operandToken)) {
+		return nil, operandToken.errorf("expected value, got %s", operandToken)
+	}
+	operand := operandToken.value
+
+	switch operator.value {
+	case "=", "==":
+		return anyValue(values, func(value string) bool { return value == operand }), nil
+	case "!=":
+		equal := anyValue(values, func(value string) bool { return value == operand })
+		return func(e *auditEvent) bool { return !equal(e) }, nil
+	case "^=":
+		return anyValue(values, func(value string) bool { return strings.HasPrefix(value, operand) }), nil
+	case "~", "!~":
+		regex, err := regexp.Compile(operand)
+		if err != nil {
+			return nil, operandToken.errorf("bad regex: %v", err)
+		}
+		matches := anyValue(values, regex.MatchString)
+		if operator.value == "!~" {
+			return func(e *auditEvent) bool { return !matches(e) }, nil
+		}
+		return matches, nil
+	}
+
+	number, err := strconv.ParseFloat(operand, 64)
+	if err != nil {
+		return nil, operandToken.errorf("expected number for %s, got %s", operator.value, operandToken)
+	}
+	compare := map[string]func(a, b float64) bool{
+		"<":  func(a, b float64) bool { return a < b },
+		"<=": func(a, b float64) bool { return a <= b },
+		">":  func(a, b float64) bool { return a > b },
+		">=": func(a, b float64) bool { return a >= b },
+	}[operator.value]
+	return anyValue(values, func(value string) bool {
+		parsed, err := strconv.ParseFloat(value, 64)
+		return err == nil && compare(parsed, number)
+	}), nil
+}
+
+func (p *queryParser) parseValueList() ([]string, error) {
+	if open := p.advance(); open.kind != tokenLeftParen {
+		return nil, open.errorf("expected \"(\", got %s", open)
+	}
+	var values []string
+	for {
+		value := p.advance()
+		if value.kind != tokenString && value.kind != tokenWord {
+			return nil, value.errorf("expected value, got %s", value)
+		}
+		values = append(values, value.value)
+		separator := p.advance()
+		if separator.kind == tokenRightParen {
+			return values, nil
+		}
+		if separator.kind != tokenComma {
+			return nil, separator.errorf("expected \",\" or \")\", got %s", separator)
+		}
+	}
+}
+
+func isQueryKeyword(token queryToken) bool {
+	return token.isKeyword("AND") || token.isKeyword("OR") || token.isKeyword("NOT") || token.isKeyword("IN")
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	pb "github.com/kzmrv/gcsreader/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestQueryMatching(t *testing.T) {
+	events := parseEvents(t, line1, line2, line3)
+	for _, test := range []struct {
+		query    string
+		expected []bool
+	}{
+		{`verb = update`, []bool{true, true, false}},
+		{`verb in (create, patch)`, []bool{false, false, true}},
+		{`verb in (update,patch) AND objectRef.resource = "nodes"`, []bool{false, false, true}},
+		{`NOT user.username ~ "^system:node:"`, []bool{false, false, true}},
+		{`user.username !~ "^system:node:" OR objectRef.name ^= "gce-scale-cluster-minion-group-4"`, []bool{true, false, true}},
+		{`user.groups = system:nodes and (stage = ResponseComplete or stage = Panic)`, []bool{true, true, false}},
+		{`responseStatus.code >= 200 AND responseStatus.code < 300`, []bool{true, true, true}},
+		{`responseStatus.code > 399`, []bool{false, false, false}},
+		{`latency > 0.002 AND stage = ResponseComplete`, []bool{true, false, true}},
+		{`objectRef.subresource != status`, []bool{true, true, false}},
+		{`annotations.authorization.k8s.io/reason ~ "npd-binding"`, []bool{false, false, true}},
+	} {
+		predicate, err := parseQuery(test.query)
+		if err != nil {
+			t.Fatalf("%s: %v", test.query, err)
+		}
+		for i, event := range events {
+			if matched := predicate(event); matched != test.expected[i] {
+				t.Errorf("%s: expected line%v match to be %v", test.query, i+1, test.expected[i])
+			}
+		}
+	}
+}
+
+func TestQuerySyntaxErrors(t *testing.T) {
+	for _, test := range []struct {
+		query    string
+		position int
+	}{
+		{`verb =`, 7},
+		{`verb = update AND`, 18},
+		{`nonexistent = x`, 1},
+		{`verb in (create update)`, 17},
+		{`(verb = get`, 12},
+		{`verb = "get`, 8},
+		{`verb ! get`, 6},
+		{`verb ~ "("`, 8},
+		{`responseStatus.code > high`, 23},
+		{`verb = get stage = x`, 12},
+		{strings.Repeat("(", maxQueryDepth) + "(verb = get" + strings.Repeat(")", maxQueryDepth+1), maxQueryDepth + 1},
+		{strings.Repeat("NOT ", maxQueryDepth+1) + "verb = get", 4*maxQueryDepth + 1},
+	} {
+		_, err := parseQuery(test.query)
+		syntaxErr, ok := err.(*querySyntaxError)
+		if !ok {
+			t.Errorf("%s: expected syntax error, got %v", test.query, err)
+			continue
+		}
+		if syntaxErr.position != test.position {
+			t.Errorf("%s: expected error at %v, got %v", test.query, test.position, syntaxErr)
+		}
+	}
+	deepest := strings.Repeat("(", maxQueryDepth) + "verb = get" + strings.Repeat(")", maxQueryDepth)
+	if _, err := parseQuery(deepest); err != nil {
+		t.Errorf("Expected %d nested parentheses to parse, got %v", maxQueryDepth, err)
+	}
+}
+
+func TestDoWorkBadQuery(t *testing.T) {
+	err := newTestServer(nil).DoWork(&pb.Work{File: "file:///dev/null", Query: "verb = "}, &fakeWorkStream{ctx: context.Background()})
+	if status.Code(err) != codes.InvalidArgument || !strings.Contains(err.Error(), "position 8") {
+		t.Fatalf("Expected InvalidArgument with position, got %v", err)
+	}
+}
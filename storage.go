@@ -0,0 +1,512 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/kzmrv/gcsreader/internal/common"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// objectSource is a storage backend that objects can be read from.
+type objectSource interface {
+	// open reads an object from offset to its end.
+	open(ctx context.Context, location *url.URL, offset int64) (io.ReadCloser, error)
+	stat(ctx context.Context, location *url.URL) (*objectInfo, error)
+	// list returns objects whose path starts with the path of prefix.
+	list(ctx context.Context, prefix *url.URL) ([]*objectInfo, error)
+}
+
+// objectInfo describes an object found by listing a source.
+type objectInfo struct {
+	location        *url.URL
+	size            int64
+	generation      int64
+	contentEncoding string
+	updated         time.Time
+}
+
+// newObjectSources maps URI schemes to the backends serving them. HTTP
+// redirects are only followed to locations allowlist allows.
+func newObjectSources(gcsClient *storage.Client, allowlist *sourceAllowlist) map[string]objectSource {
+	httpClient := &http.Client{
+		CheckRedirect: func(request *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return allowlist.check(request.URL)
+		},
+	}
+	return map[string]objectSource{
+		"gs":    &gcsSource{client: gcsClient},
+		"file":  &localSource{},
+		"http":  &httpSource{client: httpClient},
+		"https": &httpSource{client: httpClient},
+	}
+}
+
+const maxRedirects = 10
+
+// Credential modes for reading from GCS.
+const (
+	credentialsAnonymous      = "anonymous"
+	credentialsDefault        = "default"
+	credentialsServiceAccount = "service-account"
+)
+
+// newGCSClient creates a storage client for the credentials mode and
+// checks that the credentials can actually produce a token.
+func newGCSClient(ctx context.Context, mode, credentialsFile string, opts ...option.ClientOption) (*storage.Client, error) {
+	var credentials *google.Credentials
+	var err error
+	switch mode {
+	case credentialsAnonymous:
+		opts = append(opts, option.WithoutAuthentication())
+	case credentialsDefault:
+		credentials, err = google.FindDefaultCredentials(ctx, storage.ScopeReadOnly)
+	case credentialsServiceAccount:
+		var data []byte
+		data, err = ioutil.ReadFile(credentialsFile)
+		if err == nil {
+			credentials, err = google.CredentialsFromJSON(ctx, data, storage.ScopeReadOnly)
+		}
+	default:
+		return nil, fmt.Errorf("unknown credentials mode %q", mode)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s credentials: %v", mode, err)
+	}
+
+	if credentials != nil {
+		if _, err := credentials.TokenSource.Token(); err != nil {
+			return nil, fmt.Errorf("invalid %s credentials: %v", mode, err)
+		}
+		opts = append(opts, option.WithCredentials(credentials))
+	}
+	return storage.NewClient(ctx, opts...)
+}
+
+// parseObjectPath turns a request path into an object URI.
+// Paths without a scheme are objects in the given bucket, or in the
+// default one when bucket is empty. A fragment addresses archive members.
+func (s *serverType) parseObjectPath(bucket, objectPath string) (*url.URL, error) {
+	if !strings.Contains(objectPath, "://") {
+		if bucket == "" {
+			bucket = s.defaultBucket
+		}
+		objectPath, member := splitArchiveMember(objectPath)
+		return &url.URL{Scheme: "gs", Host: bucket, Path: "/" + strings.TrimPrefix(objectPath, "/"), Fragment: member}, nil
+	}
+	location, err := url.Parse(objectPath)
+	if err != nil {
+		return nil, err
+	}
+	// Object names may contain glob characters, so '?' starts a
+	// query only for sources that are really served over HTTP.
+	if location.Scheme != "http" && location.Scheme != "https" && location.RawQuery != "" {
+		location.Path += "?" + location.RawQuery
+		location.RawQuery = ""
+	}
+	if bucket != "" && (location.Scheme != "gs" || location.Host != bucket) {
+		return nil, fmt.Errorf("object %s is not in bucket %s", objectPath, bucket)
+	}
+	return location, nil
+}
+
+// expandObjectPaths resolves object paths, prefixes (ending with "/")
+// and glob patterns to the list of objects they refer to.
+func (s *serverType) expandObjectPaths(ctx context.Context, bucket string, objectPaths []string) ([]*url.URL, error) {
+	var locations []*url.URL
+	seen := map[string]bool{}
+	for _, objectPath := range objectPaths {
+		pattern, err := s.parseObjectPath(bucket, objectPath)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if err := s.allowlist.check(pattern); err != nil {
+			return nil, err
+		}
+
+		if !common.IsObjectPattern(pattern.Path) {
+			if !seen[pattern.String()] {
+				seen[pattern.String()] = true
+				locations = append(locations, pattern)
+			}
+			continue
+		}
+		matches, err := s.listMatching(ctx, pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, status.Errorf(codes.NotFound, "no objects match %s", objectPath)
+		}
+		for _, match := range matches {
+			if !seen[match.location.String()] {
+				seen[match.location.String()] = true
+				locations = append(locations, match.location)
+			}
+		}
+	}
+	return locations, nil
+}
+
+// objectName is how a listed object can be requested again: the object
+// name for GCS objects and the full URI for everything else.
+func objectName(location *url.URL) string {
+	if location.Scheme == "gs" {
+		return strings.TrimPrefix(location.Path, "/")
+	}
+	return location.String()
+}
+
+// listMatching lists the objects under the literal part of pattern and
+// keeps the ones matching it.
+func (s *serverType) listMatching(ctx context.Context, pattern *url.URL) ([]*objectInfo, error) {
+	source, err := resolveSource(s.sources, pattern)
+	if err != nil {
+		return nil, err
+	}
+	prefix := *pattern
+	if i := strings.IndexAny(pattern.Path, common.GlobCharacters); i != -1 {
+		prefix.Path = pattern.Path[:i]
+	}
+	objects, err := source.list(ctx, &prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*objectInfo
+	for _, object := range objects {
+		matched := true
+		if prefix.Path != pattern.Path {
+			if matched, err = path.Match(pattern.Path, object.location.Path); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "bad pattern %s: %v", pattern.Path, err)
+			}
+		}
+		if matched {
+			matches = append(matches, object)
+		}
+	}
+	return matches, nil
+}
+
+// sourceAllowlist is where the worker may read from: GCS buckets, local
+// files under a root directory and HTTP(S) hosts. Local files and HTTP(S)
+// are disabled unless configured.
+type sourceAllowlist struct {
+	buckets map[string]bool
+	// localRoot is empty when local files are disabled.
+	localRoot string
+	httpHosts map[string]bool
+}
+
+func newSourceAllowlist(config *serverConfig) *sourceAllowlist {
+	allowlist := &sourceAllowlist{
+		buckets:   map[string]bool{},
+		httpHosts: map[string]bool{},
+	}
+	for _, bucket := range config.AllowedBuckets {
+		allowlist.buckets[bucket] = true
+	}
+	if config.LocalRoot != "" {
+		allowlist.localRoot = filepath.Clean(config.LocalRoot)
+	}
+	for _, host := range config.AllowedHTTPHosts {
+		allowlist.httpHosts[strings.ToLower(host)] = true
+	}
+	return allowlist
+}
+
+// check fails with PermissionDenied for locations outside of the
+// allowlist. Unknown schemes pass, they fail once their source is resolved.
+func (a *sourceAllowlist) check(location *url.URL) error {
+	switch location.Scheme {
+	case "gs":
+		if !a.buckets[location.Host] {
+			return status.Errorf(codes.PermissionDenied, "bucket %s is not allowed", location.Host)
+		}
+	case "file":
+		if a.localRoot == "" {
+			return status.Error(codes.PermissionDenied, "reading local files is disabled")
+		}
+		if location.Host != "" || !isWithinDir(a.localRoot, location.Path) {
+			return status.Errorf(codes.PermissionDenied, "%s is not under %s", location, a.localRoot)
+		}
+	case "http", "https":
+		// Hosts are allowed with any port, or with only the given one.
+		host := strings.ToLower(location.Host)
+		if !a.httpHosts[host] && !a.httpHosts[strings.ToLower(location.Hostname())] {
+			return status.Errorf(codes.PermissionDenied, "host %s is not allowed", location.Host)
+		}
+	}
+	return nil
+}
+
+// isWithinDir reports whether path is dir or under it once "." and ".."
+// are resolved. Symbolic links are followed when reading, so the
+// directory must not have links pointing out of it.
+func isWithinDir(dir, path string) bool {
+	if !filepath.IsAbs(path) {
+		return false
+	}
+	rel, err := filepath.Rel(dir, filepath.Clean(path))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func resolveSource(sources map[string]objectSource, location *url.URL) (objectSource, error) {
+	source, ok := sources[location.Scheme]
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unsupported object scheme %q", location.Scheme)
+	}
+	return source, nil
+}
+
+type gcsSource struct {
+	client *storage.Client
+}
+
+func (s *gcsSource) open(ctx context.Context, location *url.URL, offset int64) (io.ReadCloser, error) {
+	bucket := s.client.Bucket(location.Host)
+
+	remoteFile := bucket.Object(strings.TrimPrefix(location.Path, "/")).ReadCompressed(true)
+	reader, err := remoteFile.NewRangeReader(ctx, offset, -1)
+	if err != nil {
+		return nil, gcsError(err)
+	}
+
+	return reader, nil
+}
+
+func (s *gcsSource) stat(ctx context.Context, location *url.URL) (*objectInfo, error) {
+	attrs, err := s.client.Bucket(location.Host).Object(strings.TrimPrefix(location.Path, "/")).Attrs(ctx)
+	if err != nil {
+		return nil, gcsError(err)
+	}
+	return &objectInfo{
+		location:        location,
+		size:            attrs.Size,
+		generation:      attrs.Generation,
+		contentEncoding: attrs.ContentEncoding,
+		updated:         attrs.Updated,
+	}, nil
+}
+
+func (s *gcsSource) list(ctx context.Context, prefix *url.URL) ([]*objectInfo, error) {
+	query := &storage.Query{Prefix: strings.TrimPrefix(prefix.Path, "/")}
+	objects := s.client.Bucket(prefix.Host).Objects(ctx, query)
+	var infos []*objectInfo
+	for {
+		attrs, err := objects.Next()
+		if err == iterator.Done {
+			return infos, nil
+		}
+		if err != nil {
+			return nil, gcsError(err)
+		}
+		infos = append(infos, &objectInfo{
+			location:        &url.URL{Scheme: prefix.Scheme, Host: attrs.Bucket, Path: "/" + attrs.Name},
+			size:            attrs.Size,
+			generation:      attrs.Generation,
+			contentEncoding: attrs.ContentEncoding,
+			updated:         attrs.Updated,
+		})
+	}
+}
+
+// gcsError converts GCS failures into gRPC statuses.
+func gcsError(err error) error {
+	var apiErr *googleapi.Error
+	switch {
+	case errors.Is(err, storage.ErrObjectNotExist) || errors.Is(err, storage.ErrBucketNotExist):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.As(err, &apiErr):
+		return status.Error(httpStatusCode(apiErr.Code), apiErr.Error())
+	}
+	return storageError(err)
+}
+
+// httpStatusCode maps HTTP statuses of storage backends to gRPC codes.
+func httpStatusCode(code int) codes.Code {
+	switch {
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return codes.PermissionDenied
+	case code == http.StatusNotFound:
+		return codes.NotFound
+	case code == http.StatusTooManyRequests || code >= http.StatusInternalServerError:
+		return codes.Unavailable
+	}
+	return codes.Unknown
+}
+
+// storageError treats failures talking to a backend that are not already
+// gRPC statuses as transient, unless the request was cancelled.
+func storageError(err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+	return status.Error(codes.Unavailable, err.Error())
+}
+
+// storageReader stops reading an object once ctx is done, even for
+// sources that ignore it, and reports failures as transient.
+type storageReader struct {
+	ctx context.Context
+	io.ReadCloser
+}
+
+func (r *storageReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, status.FromContextError(err).Err()
+	}
+	n, err := r.ReadCloser.Read(p)
+	return n, storageError(err)
+}
+
+type localSource struct{}
+
+func (*localSource) open(_ context.Context, location *url.URL, offset int64) (io.ReadCloser, error) {
+	file, err := os.Open(location.Path)
+	if err != nil {
+		return nil, localError(err)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// stat uses the modification time as the generation of local files.
+func (*localSource) stat(_ context.Context, location *url.URL) (*objectInfo, error) {
+	info, err := os.Stat(location.Path)
+	if err != nil {
+		return nil, localError(err)
+	}
+	return &objectInfo{
+		location:   location,
+		size:       info.Size(),
+		generation: info.ModTime().UnixNano(),
+		updated:    info.ModTime(),
+	}, nil
+}
+
+func localError(err error) error {
+	switch {
+	case os.IsNotExist(err):
+		return status.Error(codes.NotFound, err.Error())
+	case os.IsPermission(err):
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return err
+}
+
+func (*localSource) list(_ context.Context, prefix *url.URL) ([]*objectInfo, error) {
+	root := prefix.Path
+	if !strings.HasSuffix(root, "/") {
+		root = filepath.Dir(root)
+	}
+	var objects []*objectInfo
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() && strings.HasPrefix(path, prefix.Path) {
+			objects = append(objects, &objectInfo{
+				location: &url.URL{Scheme: prefix.Scheme, Path: path},
+				size:     info.Size(),
+				updated:  info.ModTime(),
+			})
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return objects, err
+}
+
+type httpSource struct {
+	client *http.Client
+}
+
+func (s *httpSource) open(ctx context.Context, location *url.URL, offset int64) (io.ReadCloser, error) {
+	request, err := http.NewRequest(http.MethodGet, location.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	// Asking for gzip explicitly stops the transport from transparently
+	// decompressing the body, so we always get the stored bytes.
+	request.Header.Set("Accept-Encoding", "gzip")
+	if offset > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	response, err := s.client.Do(request.WithContext(ctx))
+	if urlError, ok := err.(*url.Error); ok {
+		// Keep the code of redirects the allowlist refused.
+		if _, ok := status.FromError(urlError.Err); ok {
+			return nil, urlError.Err
+		}
+	}
+	if err != nil {
+		return nil, storageError(err)
+	}
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusPartialContent {
+		response.Body.Close()
+		return nil, status.Errorf(httpStatusCode(response.StatusCode), "failed to fetch %s: %s", location, response.Status)
+	}
+	// Servers may ignore the range and return the whole object.
+	if offset > 0 && response.StatusCode == http.StatusOK {
+		if _, err := io.CopyN(ioutil.Discard, response.Body, offset); err != nil {
+			response.Body.Close()
+			return nil, storageError(err)
+		}
+	}
+	return response.Body, nil
+}
+
+func (*httpSource) stat(_ context.Context, location *url.URL) (*objectInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "no object generations for %s", location.Scheme)
+}
+
+func (*httpSource) list(_ context.Context, prefix *url.URL) ([]*objectInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "listing is not supported for %s", prefix.Scheme)
+}
@@ -0,0 +1,470 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	pb "github.com/kzmrv/gcsreader/proto"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseObjectPathDefaultsToBucket(t *testing.T) {
+	config := defaultConfig()
+	config.DefaultBucket = "scale-tests"
+	s := newServer(config, newSourceAllowlist(config), nil, nil)
+	location, err := s.parseObjectPath("", "logs/310/artifacts/kube-apiserver-audit.log.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "gs://scale-tests/logs/310/artifacts/kube-apiserver-audit.log.gz"
+	if location.String() != expected {
+		t.Fatalf("Expected location %s, got %s", expected, location)
+	}
+}
+
+func TestParseObjectPathWithBucket(t *testing.T) {
+	s := newTestServer(nil)
+	location, err := s.parseObjectPath("scale-tests", "logs/310/audit.log.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.String() != "gs://scale-tests/logs/310/audit.log.gz" {
+		t.Fatalf("Unexpected location %s", location)
+	}
+
+	location, err = s.parseObjectPath("scale-tests", "logs/310/bundle.tar.gz#master/audit.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.Path != "/logs/310/bundle.tar.gz" || location.Fragment != "master/audit.log" {
+		t.Fatalf("Unexpected archive location %s", location)
+	}
+
+	if _, err := s.parseObjectPath("scale-tests", "gs://scale-tests/logs/310/audit.log.gz"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.parseObjectPath("scale-tests", "gs://other/logs/310/audit.log.gz"); err == nil {
+		t.Fatal("Expected error for mismatched bucket")
+	}
+}
+
+func TestSourceAllowlist(t *testing.T) {
+	config := defaultConfig()
+	config.AllowedBuckets = []string{"kubernetes-jenkins", "scale-tests"}
+	config.LocalRoot = "/var/log/audit/"
+	config.AllowedHTTPHosts = []string{"artifacts.example.com", "127.0.0.1:8080"}
+	allowlist := newSourceAllowlist(config)
+	s := newServer(config, allowlist, nil, nil)
+	disabled := newSourceAllowlist(defaultConfig())
+	for _, test := range []struct {
+		path     string
+		allowed  bool
+		disabled bool
+	}{
+		{"gs://kubernetes-jenkins/logs/audit.log.gz", true, false},
+		{"gs://scale-tests/logs/audit.log.gz", true, false},
+		{"gs://private/logs/audit.log.gz", false, false},
+		{"file:///var/log/audit/kube-apiserver-audit.log", true, false},
+		{"file:///var/log/audit/master-*/audit.log", true, false},
+		{"file:///var/log/audit", true, false},
+		{"file:///var/log/audit-old/audit.log", false, false},
+		{"file:///var/log/audit/../../../etc/passwd", false, false},
+		{"file://host/var/log/audit/audit.log", false, false},
+		{"http://artifacts.example.com/audit.log.gz", true, false},
+		{"https://Artifacts.example.com:8443/audit.log.gz", true, false},
+		{"http://127.0.0.1:8080/audit.log.gz", true, false},
+		{"http://127.0.0.1:9090/audit.log.gz", false, false},
+		{"http://169.254.169.254/computeMetadata/v1/", false, false},
+		{"ftp://example.com/audit.log.gz", true, true},
+	} {
+		location, err := s.parseObjectPath("", test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = allowlist.check(location)
+		if test.allowed && err != nil {
+			t.Errorf("Expected %s to be allowed, got %v", test.path, err)
+		}
+		if !test.allowed && status.Code(err) != codes.PermissionDenied {
+			t.Errorf("Expected %s to be denied, got %v", test.path, err)
+		}
+		// Only the default bucket is allowed by default.
+		err = disabled.check(location)
+		if location.Scheme != "gs" && !test.disabled && status.Code(err) != codes.PermissionDenied {
+			t.Errorf("Expected %s to be denied by default, got %v", test.path, err)
+		}
+	}
+}
+
+func TestResolveUnsupportedScheme(t *testing.T) {
+	location, err := newTestServer(nil).parseObjectPath("", "ftp://example.com/audit.log.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resolveSource(newObjectSources(nil, newSourceAllowlist(defaultConfig())), location); err == nil {
+		t.Fatal("Expected error for unsupported scheme")
+	}
+}
+
+func TestDownloadFromLocalFS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gcsreader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log.gz")
+	if err := ioutil.WriteFile(path, gzipped(t, line1), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := newTestServer(nil).downloadAndDecompress(context.Background(), &url.URL{Scheme: "file", Path: path}, pb.Compression_COMPRESSION_AUTO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != line1 {
+		t.Fatalf("Expected content %s, got %s", line1, content)
+	}
+}
+
+func TestDownloadFromHTTP(t *testing.T) {
+	body := gzipped(t, line2)
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			// localhost is not among the allowed hosts.
+			http.Redirect(w, r, strings.Replace(server.URL, "127.0.0.1", "localhost", 1)+"/artifacts/audit.log.gz", http.StatusFound)
+			return
+		}
+		if r.URL.Path != "/artifacts/audit.log.gz" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	s := newTestServer(nil)
+	location, err := s.parseObjectPath("", server.URL+"/artifacts/audit.log.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := s.downloadAndDecompress(context.Background(), location, pb.Compression_COMPRESSION_AUTO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != line2 {
+		t.Fatalf("Expected content %s, got %s", line2, content)
+	}
+
+	location.Path = "/missing.log.gz"
+	if _, err := s.download(context.Background(), location, 0); status.Code(err) != codes.NotFound {
+		t.Fatalf("Expected NotFound for missing object, got %v", err)
+	}
+	location.Path = "/redirect"
+	if _, err := s.download(context.Background(), location, 0); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("Expected PermissionDenied for a redirect to another host, got %v", err)
+	}
+}
+
+func TestDownloadFromGCS(t *testing.T) {
+	gcs := newFakeGCS()
+	defer gcs.Close()
+	gcs.objects["scale-tests/logs/audit.log.gz"] = gzipped(t, line3)
+	s := newTestServer(gcs.client(t))
+
+	reader, err := s.downloadAndDecompress(context.Background(), &url.URL{Scheme: "gs", Host: "scale-tests", Path: "/logs/audit.log.gz"}, pb.Compression_COMPRESSION_AUTO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != line3 {
+		t.Fatalf("Expected content %s, got %s", line3, content)
+	}
+}
+
+func TestDownloadFromGCSPermissionDenied(t *testing.T) {
+	gcs := newFakeGCS()
+	defer gcs.Close()
+	gcs.forbidden["private"] = true
+	s := newTestServer(gcs.client(t))
+
+	_, err := s.download(context.Background(), &url.URL{Scheme: "gs", Host: "private", Path: "/logs/audit.log.gz"}, 0)
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("Expected PermissionDenied, got %v", err)
+	}
+}
+
+func TestDownloadErrorCodes(t *testing.T) {
+	gcs := newFakeGCS()
+	defer gcs.Close()
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+	}))
+	defer flaky.Close()
+	s := newTestServer(gcs.client(t))
+
+	for _, test := range []struct {
+		objectPath string
+		expected   codes.Code
+	}{
+		{"file:///nonexistent/audit.log.gz", codes.NotFound},
+		{"gs://kubernetes-jenkins/missing/audit.log.gz", codes.NotFound},
+		{flaky.URL + "/audit.log.gz", codes.Unavailable},
+		{"ftp://example.com/audit.log.gz", codes.InvalidArgument},
+	} {
+		location, err := s.parseObjectPath("", test.objectPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.download(context.Background(), location, 0); status.Code(err) != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.objectPath, test.expected, err)
+		}
+	}
+}
+
+func TestExpandGlobInGCS(t *testing.T) {
+	gcs := newFakeGCS()
+	defer gcs.Close()
+	for _, name := range []string{
+		"logs/310/artifacts/master-a/kube-apiserver-audit.log.gz",
+		"logs/310/artifacts/master-a/kube-apiserver-audit.log-1.gz",
+		"logs/310/artifacts/master-b/kube-apiserver-audit.log.gz",
+		"logs/310/artifacts/master-b/kube-apiserver.log.gz",
+		"logs/310/artifacts/nodes/node-a/kube-apiserver-audit.log.gz",
+	} {
+		gcs.objects[defaultBucket+"/"+name] = nil
+	}
+	s := newTestServer(gcs.client(t))
+
+	locations, err := s.expandObjectPaths(context.Background(), "", []string{
+		"logs/310/artifacts/*/kube-apiserver-audit.log*",
+		"logs/310/artifacts/master-b/kube-apiserver-audit.log.gz",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"gs://kubernetes-jenkins/logs/310/artifacts/master-a/kube-apiserver-audit.log-1.gz",
+		"gs://kubernetes-jenkins/logs/310/artifacts/master-a/kube-apiserver-audit.log.gz",
+		"gs://kubernetes-jenkins/logs/310/artifacts/master-b/kube-apiserver-audit.log.gz",
+	}
+	if len(locations) != len(expected) {
+		t.Fatalf("Expected %v objects, got %v", expected, locations)
+	}
+	for i, location := range locations {
+		if location.String() != expected[i] {
+			t.Errorf("Expected object %s, got %s", expected[i], location)
+		}
+	}
+
+	if _, err := s.expandObjectPaths(context.Background(), "", []string{"logs/311/*"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("Expected NotFound for pattern without matches, got %v", err)
+	}
+}
+
+func TestExpandPrefixInLocalFS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gcsreader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a/audit.log.gz", "a/b/audit.log.gz", "c/audit.log.gz"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	locations, err := newTestServer(nil).expandObjectPaths(context.Background(), "", []string{"file://" + dir + "/a/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locations) != 2 {
+		t.Fatalf("Expected 2 objects, got %v", locations)
+	}
+}
+
+func TestNewGCSClientCredentialModes(t *testing.T) {
+	ctx := context.Background()
+	if _, err := newGCSClient(ctx, "unknown", ""); err == nil {
+		t.Fatal("Expected error for unknown credentials mode")
+	}
+	if _, err := newGCSClient(ctx, credentialsServiceAccount, "/nonexistent/key.json"); err == nil {
+		t.Fatal("Expected error for missing service account file")
+	}
+	client, err := newGCSClient(ctx, credentialsAnonymous, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+}
+
+// newTestServer reads from the default bucket, any local file and test
+// HTTP servers.
+func newTestServer(gcsClient *storage.Client) *serverType {
+	config := defaultConfig()
+	config.AllowedBuckets = []string{defaultBucket}
+	config.LocalRoot = "/"
+	config.AllowedHTTPHosts = []string{"127.0.0.1"}
+	allowlist := newSourceAllowlist(config)
+	return newServer(config, allowlist, newObjectSources(gcsClient, allowlist), nil)
+}
+
+// fakeGCS serves objects over the GCS XML API and lists them over the
+// JSON API.
+type fakeGCS struct {
+	*httptest.Server
+	objects   map[string][]byte
+	forbidden map[string]bool
+
+	mu sync.Mutex
+	// downloads counts the reads of each object.
+	downloads map[string]int
+}
+
+func newFakeGCS() *fakeGCS {
+	gcs := &fakeGCS{objects: map[string][]byte{}, forbidden: map[string]bool{}, downloads: map[string]int{}}
+	gcs.Server = httptest.NewServer(http.HandlerFunc(gcs.serve))
+	return gcs
+}
+
+func (f *fakeGCS) serve(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	api := strings.HasPrefix(path, "storage/v1/b/")
+	listing := api && strings.HasSuffix(path, "/o")
+	if api {
+		path = strings.Replace(strings.TrimSuffix(strings.TrimPrefix(path, "storage/v1/b/"), "/o"), "/o/", "/", 1)
+	}
+	bucket := strings.SplitN(path, "/", 2)[0]
+	if f.forbidden[bucket] {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if listing {
+		f.list(w, bucket, r.URL.Query().Get("prefix"))
+		return
+	}
+	content, ok := f.objects[path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if api {
+		json.NewEncoder(w).Encode(f.attrs(bucket, strings.TrimPrefix(path, bucket+"/")))
+		return
+	}
+	f.mu.Lock()
+	f.downloads[path]++
+	f.mu.Unlock()
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Write(content)
+}
+
+func (f *fakeGCS) attrs(bucket, name string) map[string]string {
+	return map[string]string{
+		"bucket":          bucket,
+		"name":            name,
+		"size":            strconv.Itoa(len(f.objects[bucket+"/"+name])),
+		"generation":      "1546441276105964",
+		"contentEncoding": "gzip",
+		"updated":         "2019-01-02T15:01:16.105Z",
+	}
+}
+
+func (f *fakeGCS) list(w http.ResponseWriter, bucket, prefix string) {
+	var names []string
+	for key := range f.objects {
+		if name := strings.TrimPrefix(key, bucket+"/"); name != key && strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	items := []map[string]string{}
+	for _, name := range names {
+		items = append(items, f.attrs(bucket, name))
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"kind": "storage#objects", "items": items})
+}
+
+func (f *fakeGCS) client(t *testing.T) *storage.Client {
+	client, err := newGCSClient(context.Background(), credentialsAnonymous, "", option.WithEndpoint(f.URL+"/storage/v1/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func writeTempFile(t *testing.T, name string, content []byte) string {
+	dir, err := ioutil.TempDir("", "gcsreader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func gzipped(t *testing.T, content string) []byte {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	pb "github.com/kzmrv/gcsreader/proto"
+)
+
+// timestampSelector picks the time a line is filtered and reported by. It
+// returns false when the line has no such field.
+type timestampSelector func(entry *logEntry) (time.Time, bool)
+
+// newTimestampSelector returns nil for the received timestamp, which
+// parseLine already sets on every entry.
+func newTimestampSelector(field pb.TimestampField, jsonPath string) (timestampSelector, error) {
+	switch field {
+	case pb.TimestampField_TIMESTAMP_RECEIVED:
+		return nil, nil
+	case pb.TimestampField_TIMESTAMP_STAGE:
+		return func(entry *logEntry) (time.Time, bool) {
+			return entry.event.StageTimestamp, !entry.event.StageTimestamp.IsZero()
+		}, nil
+	case pb.TimestampField_TIMESTAMP_PATH:
+		if jsonPath == "" {
+			return nil, fmt.Errorf("no timestamp path given")
+		}
+		path, err := parseJSONPath(jsonPath)
+		if err != nil {
+			return nil, fmt.Errorf("bad timestamp path: %v", err)
+		}
+		return func(entry *logEntry) (time.Time, bool) {
+			return lookupTimestamp(*entry.log, path)
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown timestamp field %v", field)
+}
+
+// lookupTimestamp finds an RFC 3339 timestamp at path in line.
+func lookupTimestamp(line string, path []string) (time.Time, bool) {
+	var document map[string]json.RawMessage
+	if err := json.NewDecoder(strings.NewReader(line)).Decode(&document); err != nil {
+		return time.Time{}, false
+	}
+	value, ok := lookupJSONPath(document, path)
+	if !ok {
+		return time.Time{}, false
+	}
+	var timestamp time.Time
+	if err := json.Unmarshal(value, &timestamp); err != nil || timestamp.IsZero() {
+		return time.Time{}, false
+	}
+	return timestamp, true
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/kzmrv/gcsreader/proto"
+)
+
+const creationLine = `{"kind":"Event","apiVersion":"audit.k8s.io/v1beta1","metadata":{"creationTimestamp":"2019-01-02T15:02:00Z"},"timestamp":"2019-01-02T15:01:16Z","stageTimestamp":"2019-01-02T15:01:17Z","auditID":"0286b87c","stage":"ResponseComplete","verb":"watch"}`
+
+func TestTimestampSelector(t *testing.T) {
+	for _, test := range []struct {
+		field    pb.TimestampField
+		path     string
+		line     string
+		expected time.Time
+	}{
+		{pb.TimestampField_TIMESTAMP_STAGE, "", line3, time.Unix(1546441276, 108460000)},
+		{pb.TimestampField_TIMESTAMP_PATH, "metadata.creationTimestamp", creationLine, time.Unix(1546441320, 0)},
+		{pb.TimestampField_TIMESTAMP_PATH, "stageTimestamp", creationLine, time.Unix(1546441277, 0)},
+		// Missing or malformed fields fall back to the received timestamp.
+		{pb.TimestampField_TIMESTAMP_PATH, "metadata.creationTimestamp", line3, time.Unix(1546441276, 104561000)},
+		{pb.TimestampField_TIMESTAMP_PATH, "verb", creationLine, time.Unix(1546441276, 0)},
+		{pb.TimestampField_TIMESTAMP_STAGE, "", `{"kind":"Event","apiVersion":"audit.k8s.io/v1","requestReceivedTimestamp":"2019-01-02T15:01:16Z"}`, time.Unix(1546441276, 0)},
+	} {
+		selector, err := newTimestampSelector(test.field, test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := readLines(t, test.line, &lineFilter{regex: regexp.MustCompile(""), timestamp: selector})
+		if len(lines) != 1 || !lines[0].time.Equal(test.expected) {
+			t.Errorf("%v %s: expected time %s, got %v", test.field, test.path, test.expected.UTC(), lines)
+		}
+	}
+}
+
+func TestTimestampSelectorWindow(t *testing.T) {
+	selector, err := newTimestampSelector(pb.TimestampField_TIMESTAMP_STAGE, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := readLines(t, creationLine, &lineFilter{
+		regex:     regexp.MustCompile(""),
+		since:     time.Unix(1546441276, 500000000),
+		timestamp: selector,
+	})
+	if len(lines) != 1 {
+		t.Fatalf("Expected the line completing inside the window, got %v", lines)
+	}
+}
+
+func TestBadTimestampSelector(t *testing.T) {
+	for _, test := range []struct {
+		field pb.TimestampField
+		path  string
+	}{
+		{pb.TimestampField_TIMESTAMP_PATH, ""},
+		{pb.TimestampField_TIMESTAMP_PATH, "metadata..creationTimestamp"},
+		{pb.TimestampField(42), ""},
+	} {
+		if _, err := newTimestampSelector(test.field, test.path); err == nil {
+			t.Errorf("Expected error for %v %q", test.field, test.path)
+		}
+	}
+}
+
+func readLines(t *testing.T, text string, filters *lineFilter) []*logEntry {
+	ch := make(chan *lineEntry, 100)
+	if err := getMatchingLines(context.Background(), strings.NewReader(text), ch, filters, ""); err != nil {
+		t.Fatal(err)
+	}
+	close(ch)
+	var lines []*logEntry
+	for line := range ch {
+		if line.logEntry != nil {
+			lines = append(lines, line.logEntry)
+		}
+	}
+	return lines
+}